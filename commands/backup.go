@@ -0,0 +1,358 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/rancher"
+	"github.com/SvenDowideit/desktop/util"
+
+	"github.com/docker/machine/libmachine/host"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// restoreTmp is where `restore` copies the backup to in the vm
+const restoreTmp = "/tmp/desktop-restore.tar.gz"
+
+var Backup = cli.Command{
+	Name:      "backup",
+	Usage:     "Save the Rancher Server's database to a .tar.gz file on this computer",
+	ArgsUsage: "<file.tar.gz>",
+	Action: func(context *cli.Context) error {
+		out := context.Args().First()
+		if out == "" {
+			return fmt.Errorf("Please specify the backup file to create")
+		}
+		client := newMachineClient(false)
+		defer client.Close()
+		h, ip, err := runningMachine(client, config.Current.Machine.Name)
+		if err != nil {
+			return err
+		}
+		state := containerState(h, serverContainer)
+		if state == "" {
+			return fmt.Errorf("There is no Rancher Server in the %s vm to back up", config.Current.Machine.Name)
+		}
+		data, err := serverDataSource(h)
+		if err != nil {
+			return err
+		}
+
+		// stop the server so the database files are consistent
+		if state == "running" {
+			log.Infof("Stopping the Rancher Server while it is backed up")
+			if err := sshRun(h, "docker stop "+serverContainer); err != nil {
+				return err
+			}
+			defer func() {
+				if err := sshRun(h, "docker start "+serverContainer); err != nil {
+					log.Error(err)
+					return
+				}
+				log.Infof("Restarted the Rancher Server at http://%s", ip)
+			}()
+		}
+
+		log.Infof("Backing up %s in the vm to %s", data, out)
+		if err := sshDownload(h, "sudo tar czf - -C "+data+" .", out); err != nil {
+			return err
+		}
+		log.Infof("Backed up the Rancher Server to %s", out)
+		return nil
+	},
+}
+
+var Restore = cli.Command{
+	Name:      "restore",
+	Usage:     "Replace the Rancher Server's database with one saved by `desktop backup`",
+	ArgsUsage: "<file.tar.gz>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "server-image",
+			Usage: "Rancher Server image to create the server container from, if there isn't one",
+		},
+		cli.StringFlag{
+			Name:  "server-version",
+			Usage: "Rancher Server image tag, if there isn't a server container",
+		},
+		cli.StringFlag{
+			Name:  "server-data",
+			Usage: "Directory in the vm to keep the Rancher Server's database in",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Don't ask for confirmation before replacing the Rancher Server's database",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		in := context.Args().First()
+		if in == "" {
+			return fmt.Errorf("Please specify the backup file to restore")
+		}
+		if _, err := os.Stat(in); err != nil {
+			return err
+		}
+		s := serverSettings(context)
+		client := newMachineClient(false)
+		defer client.Close()
+		h, ip, err := runningMachine(client, config.Current.Machine.Name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("This will replace the Rancher Server's database in %s in the %s vm with %s\n", s.DataDir, config.Current.Machine.Name, in)
+		if !context.Bool("force") && !confirm("Continue?") {
+			return fmt.Errorf("Restore cancelled, use --force to restore without being asked")
+		}
+
+		log.Infof("Copying %s to the vm", in)
+		if err := sshUpload(h, in, restoreTmp); err != nil {
+			return err
+		}
+		defer h.RunSSHCommand("rm -f " + restoreTmp)
+
+		if err := checkReplacedServerData(h, s); err != nil {
+			return err
+		}
+		// extract next to s.DataDir first, so a bad backup doesn't touch the server
+		restoreDir := s.DataDir + "-restore"
+		defer h.RunSSHCommand("sudo rm -rf " + restoreDir)
+		for _, cmd := range []string{
+			"sudo rm -rf " + restoreDir,
+			"sudo mkdir -p " + restoreDir,
+			"sudo tar xzf " + restoreTmp + " -C " + restoreDir,
+		} {
+			if err := sshRun(h, cmd); err != nil {
+				return err
+			}
+		}
+
+		state := containerState(h, serverContainer)
+		if state == "running" {
+			log.Infof("Stopping the Rancher Server")
+			if err := sshRun(h, "docker stop "+serverContainer); err != nil {
+				return err
+			}
+		}
+		// from here on, anything that goes wrong puts back the original data and server
+		renamed := false
+		undo := func(err error) error {
+			log.Errorf("Restoring %s failed (%s), putting back the original Rancher Server", in, err)
+			if undoErr := undoRestore(h, s, state, renamed); undoErr != nil {
+				return fmt.Errorf("%s, and putting back the original Rancher Server failed (%s). Its data is in %s in the vm", err, undoErr, replacedServerData(s))
+			}
+			return err
+		}
+
+		// a container that doesn't use s.DataDir is replaced by one that does, keeping the
+		// original until the restored server is ready
+		if state != "" {
+			mounts, err := containerInspect(h, serverContainer, mountsFormat)
+			if err != nil {
+				return undo(err)
+			}
+			if !containsMount(mounts, s.DataDir+":/var/lib/mysql") {
+				// a previous failed upgrade or restore may have left its container behind
+				h.RunSSHCommand("docker rm -f " + previousServerContainer)
+				if err := sshRun(h, "docker rename "+serverContainer+" "+previousServerContainer); err != nil {
+					return undo(err)
+				}
+				renamed = true
+			}
+		}
+
+		log.Infof("Restoring the Rancher Server data into %s in the vm", s.DataDir)
+		replaced := replacedServerData(s)
+		for _, cmd := range []string{
+			"if [ -e " + s.DataDir + " ]; then sudo mv " + s.DataDir + " " + replaced + "; fi",
+			"sudo mv " + restoreDir + " " + s.DataDir,
+		} {
+			if err := sshRun(h, cmd); err != nil {
+				return undo(err)
+			}
+		}
+
+		if err := startServer(h, s); err != nil {
+			return undo(err)
+		}
+		err = util.WaitFor("the restored Rancher Server to be ready", serverTimeout, func() (bool, error) {
+			err := rancher.Healthy("http://" + ip)
+			return err == nil, err
+		})
+		if err != nil {
+			return undo(err)
+		}
+
+		if err := sshRun(h, "sudo rm -rf "+replaced); err != nil {
+			log.Warn(err)
+		}
+		if renamed {
+			if err := sshRun(h, "docker rm "+previousServerContainer); err != nil {
+				log.Warn(err)
+			}
+		}
+		log.Infof("Restored %s, the Rancher Server is at http://%s", in, ip)
+		return nil
+	},
+}
+
+// undoRestore puts back the server data that restore moved aside, and the server container
+// as it was before: state is the container's state then, and renamed is true if restore
+// renamed it to make way for a new one
+func undoRestore(h *host.Host, s config.ServerSettings, state string, renamed bool) error {
+	if renamed || state == "" {
+		// remove the container restore created
+		h.RunSSHCommand("docker rm -f " + serverContainer)
+	} else {
+		h.RunSSHCommand("docker stop " + serverContainer)
+	}
+	if renamed {
+		if err := sshRun(h, "docker rename "+previousServerContainer+" "+serverContainer); err != nil {
+			return err
+		}
+	}
+	if err := restoreServerData(h, s); err != nil {
+		return err
+	}
+	if state == "running" {
+		return sshRun(h, "docker start "+serverContainer)
+	}
+	return nil
+}
+
+// serverDataSource returns the directory in the vm that holds the server container's database
+func serverDataSource(h *host.Host) (string, error) {
+	mounts, err := containerInspect(h, serverContainer, mountsFormat)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range strings.Fields(mounts) {
+		if strings.HasSuffix(m, ":/var/lib/mysql") {
+			return strings.TrimSuffix(m, ":/var/lib/mysql"), nil
+		}
+	}
+	return "", fmt.Errorf("The Rancher Server container has no /var/lib/mysql volume to back up")
+}
+
+// sshDownload runs cmd in the vm, writing its output to the local file to
+func sshDownload(h *host.Host, cmd, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	part, err := ioutil.TempFile(filepath.Dir(to), filepath.Base(to)+".part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part.Name()) // clean up if we fail
+	err = sshStream(h, cmd, func(stdout io.Reader) error {
+		_, err := io.Copy(part, stdout)
+		return err
+	})
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(part.Name(), to)
+}
+
+// uploadChunkSize is how much of a file sshUpload sends per command. Base64 encoded, it has
+// to fit in one command line argument (128KiB on Linux).
+const uploadChunkSize = 64 * 1024
+
+// sshUpload copies the local file from to the file to in the vm, and checks it arrived intact.
+// The ssh client can't write to a command's stdin, so the file is sent in base64 chunks.
+func sshUpload(h *host.Host, from, to string) error {
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sshClient, err := h.CreateSSHClient()
+	if err != nil {
+		return err
+	}
+	run := func(cmd string) (string, error) {
+		out, err := sshClient.Output(cmd)
+		if err != nil {
+			return out, fmt.Errorf("Error copying %s to %s in the vm (%s): %s", from, to, err, strings.TrimSpace(out))
+		}
+		return out, nil
+	}
+	if _, err := run("rm -f " + to + " && (umask 077 && touch " + to + ")"); err != nil {
+		return err
+	}
+
+	sum := sha256.New()
+	r := io.TeeReader(f, sum)
+	buf := make([]byte, uploadChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := run("echo " + base64.StdEncoding.EncodeToString(buf[:n]) + " | base64 -d >> " + to); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := run("sha256sum " + to)
+	if err != nil {
+		return err
+	}
+	expected := hex.EncodeToString(sum.Sum(nil))
+	if fields := strings.Fields(out); len(fields) == 0 || fields[0] != expected {
+		return fmt.Errorf("Error copying %s to %s in the vm: it has sha256 %s, expected %s", from, to, strings.TrimSpace(out), expected)
+	}
+	return nil
+}
+
+// sshStream runs cmd in the vm, passing its output to read
+func sshStream(h *host.Host, cmd string, read func(io.Reader) error) error {
+	sshClient, err := h.CreateSSHClient()
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := sshClient.Start(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stdout.Close()
+		_ = stderr.Close()
+	}()
+	errOut := &bytes.Buffer{}
+	errDone := make(chan struct{})
+	go func() {
+		io.Copy(errOut, stderr)
+		close(errDone)
+	}()
+
+	if err := read(stdout); err != nil {
+		return err
+	}
+	// read may stop early (like at the end of a tar archive), and cmd can't finish until it's written everything
+	io.Copy(ioutil.Discard, stdout)
+	if err := sshClient.Wait(); err != nil {
+		<-errDone
+		return fmt.Errorf("Error running `%s` in the vm (%s): %s", cmd, err, strings.TrimSpace(errOut.String()))
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/download"
+	"github.com/SvenDowideit/desktop/util"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// BundleVersion is the bundle.json format version this build understands
+const BundleVersion = 1
+
+const bundleManifestFile = "bundle.json"
+
+// fromBundle is set when `install --from-bundle` is used
+var fromBundle *BundleManifest
+
+// BundleTool is one pre-fetched file in a bundle
+type BundleTool struct {
+	Command string `json:"command"`
+	Version string `json:"version,omitempty"`
+	File    string `json:"file"`
+	Sha256  string `json:"sha256"`
+}
+
+// BundleManifest is the bundle.json at the top of an offline install bundle
+type BundleManifest struct {
+	Version  int                     `json:"version"`
+	Created  time.Time               `json:"created"`
+	Profiles map[string][]BundleTool `json:"profiles"`
+	Iso      *BundleTool             `json:"iso,omitempty"`
+
+	// Dir is where the bundle's files are on disk
+	Dir string `json:"-"`
+}
+
+var Bundle = cli.Command{
+	Name:  "bundle",
+	Usage: "Manage offline install bundles",
+	Subcommands: []cli.Command{
+		cli.Command{
+			Name:      "create",
+			Usage:     "Download all the tools and the RancherOS iso into a bundle for `desktop install --from-bundle`",
+			ArgsUsage: "<dir|file.tar.gz>",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "profile",
+					Usage: "Install profile (GOOS/GOARCH, eg darwin/amd64) to include in the bundle (default: this computer's)",
+					Value: &cli.StringSlice{},
+				},
+				cli.StringFlag{
+					Name:        "manifest",
+					Usage:       "YAML or JSON install manifest (file or URL) to use instead of the built-in tool list",
+					EnvVar:      "DESKTOP_MANIFEST",
+					Destination: &manifestPath,
+				},
+				cli.BoolFlag{
+					Name:        "insecure-skip-checksum",
+					Usage:       "Bundle tools that have no sha256 or checksumurl to verify them against",
+					EnvVar:      "DESKTOP_INSECURE_SKIP_CHECKSUM",
+					Destination: &skipChecksums,
+				},
+			},
+			Action: createBundle,
+		},
+	},
+}
+
+func createBundle(context *cli.Context) error {
+	out := context.Args().First()
+	if out == "" {
+		return fmt.Errorf("Please specify the bundle directory or .tar.gz file to create")
+	}
+	installCfg, err := config.LoadInstallCfg(manifestPath)
+	if err != nil {
+		return err
+	}
+	profiles := context.StringSlice("profile")
+	if len(profiles) == 0 {
+		profiles = []string{config.CurrentProfile()}
+	}
+
+	dir := out
+	if isTGZ(out) {
+		dir, err = ioutil.TempDir("", "desktop-bundle")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir) // clean up
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b := &BundleManifest{
+		Version:  BundleVersion,
+		Created:  time.Now().UTC(),
+		Profiles: map[string][]BundleTool{},
+	}
+	for _, profile := range profiles {
+		files, err := config.Profile(installCfg, profile)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, profile), 0755); err != nil {
+			return err
+		}
+		for _, v := range files {
+			version, err := resolveVersion(v, profile)
+			if err != nil {
+				return err
+			}
+			log.Infof("Downloading %s %s for %s.", v.Command, version, profile)
+			downloaded, filename, err := downloadApp(v, profile, version)
+			if err != nil {
+				os.Remove(downloaded)
+				return err
+			}
+			tool, err := addToBundle(dir, filepath.Join(profile, filename), downloaded)
+			if err != nil {
+				return err
+			}
+			tool.Command = v.Command
+			tool.Version = version
+			b.Profiles[profile] = append(b.Profiles[profile], *tool)
+		}
+	}
+
+	log.Infof("Downloading %s.", config.RancherOSIsoUrl)
+	cache, err := util.CacheDir()
+	if err != nil {
+		return err
+	}
+	iso := filepath.Join(cache, "rancheros.iso")
+	if err := wget(config.RancherOSIsoUrl, iso); err != nil {
+		return err
+	}
+	verified, err := verifyIso(iso)
+	if err != nil {
+		return err
+	}
+	b.Iso, err = addToBundle(dir, "rancheros.iso", verified)
+	if err != nil {
+		return err
+	}
+	b.Iso.Command = "rancheros"
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, bundleManifestFile), data, 0644); err != nil {
+		return err
+	}
+
+	if isTGZ(out) {
+		if err := writeTGZ(dir, out); err != nil {
+			return err
+		}
+	}
+	log.Infof("Created bundle %s, install it with `desktop install --from-bundle %s`", out, out)
+	return nil
+}
+
+// addToBundle moves the downloaded file into the bundle dir as name
+func addToBundle(dir, name, downloaded string) (*BundleTool, error) {
+	to := filepath.Join(dir, name)
+	if err := os.Rename(downloaded, to); err != nil {
+		// most likely a different filesystem
+		if err := copyFile(downloaded, to); err != nil {
+			return nil, err
+		}
+		os.Remove(downloaded)
+	}
+	sum, err := util.Sha256File(to)
+	if err != nil {
+		return nil, err
+	}
+	return &BundleTool{File: filepath.ToSlash(name), Sha256: sum}, nil
+}
+
+// OpenBundle reads the bundle.json from a bundle directory, or extracts a .tar.gz bundle
+// into a temporary directory first. The returned func removes anything that was extracted.
+func OpenBundle(path string) (*BundleManifest, func(), error) {
+	cleanup := func() {}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	dir := path
+	if !fi.IsDir() {
+		dir, err = ioutil.TempDir("", "desktop-bundle")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		log.Infof("Extracting %s", path)
+		if err := extractTGZ(path, dir); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, bundleManifestFile))
+	if err != nil {
+		cleanup()
+		return nil, func() {}, fmt.Errorf("%s is not a desktop bundle (%s)", path, err)
+	}
+	b := &BundleManifest{}
+	if err := json.Unmarshal(data, b); err != nil {
+		cleanup()
+		return nil, func() {}, fmt.Errorf("Error parsing %s in %s (%s)", bundleManifestFile, path, err)
+	}
+	if b.Version != BundleVersion {
+		cleanup()
+		return nil, func() {}, fmt.Errorf("Bundle %s is version %d, this desktop only understands version %d", path, b.Version, BundleVersion)
+	}
+	b.Dir = dir
+	return b, cleanup, nil
+}
+
+// Tool returns the bundled file for command in the given install profile
+func (b *BundleManifest) Tool(profile, command string) (*BundleTool, error) {
+	for _, t := range b.Profiles[profile] {
+		if t.Command == command {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("Bundle does not contain %s for %s", command, profile)
+}
+
+// InstallCfg lists the bundled tools in the same form as config.InstallCfg
+func (b *BundleManifest) InstallCfg() map[string][]config.InstallFile {
+	cfg := map[string][]config.InstallFile{}
+	for profile, tools := range b.Profiles {
+		for _, t := range tools {
+			cfg[profile] = append(cfg[profile], config.InstallFile{Command: t.Command})
+		}
+	}
+	return cfg
+}
+
+// verifyIso checks the downloaded RancherOS iso against the release's published checksums,
+// returning a verified copy of it
+func verifyIso(iso string) (string, error) {
+	var expected string
+	data, err := download.ReadAll(config.RancherOSIsoChecksumUrl)
+	if err == nil {
+		expected, err = util.ParseChecksums(data, "rancheros.iso")
+	}
+	if err != nil {
+		if !skipChecksums {
+			return "", fmt.Errorf("Can't verify the RancherOS iso against %s: %s (use --insecure-skip-checksum to bundle it anyway)", config.RancherOSIsoChecksumUrl, err)
+		}
+		log.Warnf("Can't verify the RancherOS iso (%s), bundling it unverified", err)
+	}
+	verified, err := util.CopyVerified(iso, filepath.Dir(iso), expected)
+	if err != nil {
+		return "", err
+	}
+	if expected != "" {
+		log.Debugf("rancheros.iso matches sha256 %s", expected)
+	}
+	return verified, nil
+}
+
+// InstallIso queues copying the bundled RancherOS iso to where `start` will use it,
+// for finishInstall to run
+func (b *BundleManifest) InstallIso() error {
+	if b.Iso == nil {
+		return nil
+	}
+	cache, err := util.CacheDir()
+	if err != nil {
+		return err
+	}
+	from, err := util.CopyVerified(filepath.Join(b.Dir, filepath.FromSlash(b.Iso.File)), cache, b.Iso.Sha256)
+	if err != nil {
+		return err
+	}
+	log.Infof("Installing RancherOS iso to %s", config.RancherOSIso)
+	installBatch.Add("mkdir", "-p", filepath.Dir(config.RancherOSIso))
+	installBatch.Add("cp", from, config.RancherOSIso)
+	pendingInstalls = append(pendingInstalls, pendingInstall{entry: ReceiptEntry{
+		Tool:   "rancheros",
+		Source: "bundle:" + b.Iso.File,
+		Sha256: b.Iso.Sha256,
+		Path:   config.RancherOSIso,
+	}, cleanup: []string{from}})
+	return nil
+}
+
+func isTGZ(filename string) bool {
+	return strings.HasSuffix(filename, ".tar.gz") || strings.HasSuffix(filename, ".tgz")
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeTGZ archives the files in dir into the .tar.gz file out
+func writeTGZ(dir, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// extractTGZ unpacks the .tar.gz file src into dir
+func extractTGZ(src, dir string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gzf, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(gzf)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(to, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("%s in %s is outside the bundle", header.Name, src)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(to, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+				return err
+			}
+			out, err := os.Create(to)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tarReader)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
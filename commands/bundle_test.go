@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTGZ(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		fails bool
+	}{
+		{"bundle", []string{"bundle.json", "linux/amd64/tool", "rancheros.iso"}, false},
+		{"absolute", []string{"/bundle.json"}, false},
+		{"parent", []string{"bundle.json", "../escaped"}, true},
+		{"nested parent", []string{"linux/../../escaped"}, true},
+		{"sibling prefix", []string{"../bundle-escaped/tool"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "bundle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			src := filepath.Join(tmp, "bundle.tar.gz")
+			writeTarball(t, src, test.files)
+			dir := filepath.Join(tmp, "bundle")
+
+			err = extractTGZ(src, dir)
+			if test.fails {
+				if err == nil {
+					t.Error("expected an error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				for _, name := range test.files {
+					if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+			for _, escaped := range []string{"escaped", "bundle-escaped"} {
+				if _, err := os.Stat(filepath.Join(tmp, escaped)); !os.IsNotExist(err) {
+					t.Errorf("%s was extracted outside the bundle", escaped)
+				}
+			}
+		})
+	}
+}
+
+func writeTarball(t *testing.T, src string, files []string) {
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for _, name := range files {
+		data := []byte(name)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
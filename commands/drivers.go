@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/SvenDowideit/desktop/config"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/drivers/hyperv"
+	"github.com/docker/machine/drivers/virtualbox"
+	"github.com/docker/machine/libmachine/drivers"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// driverConfigs build the config that each docker-machine driver plugin expects for a new vm.
+// The plugins are given the config as JSON, so the drivers that are not part of docker-machine
+// are described by structs with the same fields as the plugin's Driver.
+var driverConfigs = map[string]func(m config.MachineSettings, iso string) (interface{}, error){
+	"virtualbox":        virtualboxConfig,
+	"hyperv":            hypervConfig,
+	"xhyve":             xhyveConfig,
+	"kvm":               kvmConfig,
+	"vmwareworkstation": vmwareWorkstationConfig,
+}
+
+// newDriverConfig returns the driver config for the machine's driver
+func newDriverConfig(m config.MachineSettings) (interface{}, error) {
+	build, ok := driverConfigs[m.Driver]
+	if !ok {
+		names := []string{}
+		for name := range driverConfigs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown driver %s, expected one of %v", m.Driver, names)
+	}
+	return build(m, machineIso(m))
+}
+
+// machineIso returns the iso url to boot from, preferring one installed from an offline bundle
+func machineIso(m config.MachineSettings) string {
+	if m.Iso != config.RancherOSIsoUrl {
+		return m.Iso
+	}
+	if _, err := os.Stat(config.RancherOSIso); err == nil {
+		log.Infof("Using RancherOS iso from %s", config.RancherOSIso)
+		return "file://" + filepath.ToSlash(config.RancherOSIso)
+	}
+	return m.Iso
+}
+
+// baseDriver mirrors what the drivers' NewDriver functions set up
+func baseDriver(m config.MachineSettings) *drivers.BaseDriver {
+	return &drivers.BaseDriver{
+		MachineName: m.Name,
+		StorePath:   mcndirs.GetBaseDir(),
+		SSHUser:     "docker",
+		SSHPort:     22,
+	}
+}
+
+// resolveStorePath is drivers.BaseDriver.ResolveStorePath, which some plugins only
+// call from their command line flag handling
+func resolveStorePath(m config.MachineSettings, file string) string {
+	return filepath.Join(mcndirs.GetBaseDir(), "machines", m.Name, file)
+}
+
+func virtualboxConfig(m config.MachineSettings, iso string) (interface{}, error) {
+	d := virtualbox.NewDriver(m.Name, mcndirs.GetBaseDir())
+	d.CPU = m.CPU
+	d.Memory = m.Memory
+	d.DiskSize = m.DiskSize
+	d.Boot2DockerURL = iso
+	return d, nil
+}
+
+func hypervConfig(m config.MachineSettings, iso string) (interface{}, error) {
+	d := hyperv.NewDriver(m.Name, mcndirs.GetBaseDir())
+	d.CPU = m.CPU
+	d.MemSize = m.Memory
+	d.DiskSize = m.DiskSize
+	d.Boot2DockerURL = iso
+	return d, nil
+}
+
+// xhyveDriver is github.com/zchee/docker-machine-driver-xhyve's Driver
+type xhyveDriver struct {
+	*drivers.BaseDriver
+	Boot2DockerURL string
+	BootCmd        string
+	CPU            int
+	DiskSize       int64
+	Memory         int
+	UUID           string
+	NFSShare       bool
+}
+
+func xhyveConfig(m config.MachineSettings, iso string) (interface{}, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	bootCmd := m.BootCmd
+	if bootCmd == "" {
+		bootCmd = "rancher.debug=true"
+	}
+	nfsShare := true
+	if m.NFSShare != nil {
+		nfsShare = *m.NFSShare
+	}
+	return &xhyveDriver{
+		BaseDriver:     baseDriver(m),
+		Boot2DockerURL: iso,
+		BootCmd:        bootCmd,
+		CPU:            m.CPU,
+		DiskSize:       int64(m.DiskSize),
+		Memory:         m.Memory,
+		UUID:           uuid,
+		NFSShare:       nfsShare,
+	}, nil
+}
+
+// kvmDriver is github.com/dhiltgen/docker-machine-kvm's Driver
+type kvmDriver struct {
+	*drivers.BaseDriver
+	Memory         int
+	DiskSize       int
+	CPU            int
+	Network        string
+	PrivateNetwork string
+	ISO            string
+	Boot2DockerURL string
+	DiskPath       string
+	CacheMode      string
+	IOMode         string
+}
+
+func kvmConfig(m config.MachineSettings, iso string) (interface{}, error) {
+	return &kvmDriver{
+		BaseDriver:     baseDriver(m),
+		Memory:         m.Memory,
+		DiskSize:       m.DiskSize,
+		CPU:            m.CPU,
+		Network:        "default",
+		PrivateNetwork: "docker-machines",
+		ISO:            resolveStorePath(m, "boot2docker.iso"),
+		Boot2DockerURL: iso,
+		DiskPath:       resolveStorePath(m, m.Name+".img"),
+		CacheMode:      "default",
+		IOMode:         "threads",
+	}, nil
+}
+
+// vmwareWorkstationDriver is github.com/pecigonzalo/docker-machine-vmwareworkstation's Driver
+type vmwareWorkstationDriver struct {
+	*drivers.BaseDriver
+	Memory         int
+	DiskSize       int
+	CPU            int
+	ISO            string
+	Boot2DockerURL string
+	SSHPassword    string
+}
+
+func vmwareWorkstationConfig(m config.MachineSettings, iso string) (interface{}, error) {
+	return &vmwareWorkstationDriver{
+		BaseDriver:     baseDriver(m),
+		Memory:         m.Memory,
+		DiskSize:       m.DiskSize,
+		CPU:            m.CPU,
+		ISO:            resolveStorePath(m, "boot2docker.iso"),
+		Boot2DockerURL: iso,
+		SSHPassword:    "tcuser",
+	}, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
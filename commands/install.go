@@ -5,6 +5,8 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,7 +20,9 @@ import (
 	"time"
 
 	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/download"
 	logfile "github.com/SvenDowideit/desktop/log"
+	"github.com/SvenDowideit/desktop/release"
 	"github.com/SvenDowideit/desktop/util"
 
 	log "github.com/Sirupsen/logrus"
@@ -28,8 +32,8 @@ import (
 	"github.com/urfave/cli"
 )
 
-var binPath, softlinkPath string
-var updateFlag bool
+var binPath, softlinkPath, manifestPath, bundlePath string
+var updateFlag, skipChecksums bool
 
 var Install = cli.Command{
 	Name:  "install",
@@ -52,65 +56,128 @@ var Install = cli.Command{
 			Usage:       "Check for updated releases",
 			Destination: &updateFlag,
 		},
+		cli.StringFlag{
+			Name:        "manifest",
+			Usage:       "YAML or JSON install manifest (file or URL) to use instead of the built-in tool list",
+			EnvVar:      "DESKTOP_MANIFEST",
+			Destination: &manifestPath,
+		},
+		cli.BoolFlag{
+			Name:        "insecure-skip-checksum",
+			Usage:       "Install tools that have no sha256 or checksumurl to verify them against (mismatches are still refused)",
+			EnvVar:      "DESKTOP_INSECURE_SKIP_CHECKSUM",
+			Destination: &skipChecksums,
+		},
+		cli.StringFlag{
+			Name:        "from-bundle",
+			Usage:       "Install from a bundle directory or .tar.gz made by `desktop bundle create`, without using the network",
+			Destination: &bundlePath,
+		},
+		cli.StringFlag{
+			Name:  "channel",
+			Usage: "Release channel to update desktop from: stable, beta, nightly or a release feed URL (saved in the settings file)",
+		},
+		cli.StringSliceFlag{
+			Name:  "pin",
+			Usage: "Install a specific version or semver range of a tool, instead of the latest (tool=version, eg docker-machine=v0.8.2)",
+			Value: &cli.StringSlice{},
+		},
 	},
 	Action: func(context *cli.Context) error {
+		// the flag defaults were set before main checked if sudo can be used
+		if !context.IsSet("binpath") {
+			binPath = config.RancherBinDir
+		}
+		if !context.IsSet("softlinkpath") {
+			softlinkPath = config.GlobalBinDir
+		}
+		// --binpath and --softlinkpath may need sudo when main's directories didn't
+		sudo, err := util.CheckPrivileges(binPath, softlinkPath, config.RancherBinDir, filepath.Dir(config.RancherOSIso))
+		if err != nil {
+			return err
+		}
+		util.Sudo = util.Sudo || sudo
+		if logfile.LogDirPending() {
+			installBatch.Add("mkdir", "-p", config.LogDir)
+			installBatch.Add("chmod", "777", config.LogDir)
+		}
+
+		if context.IsSet("channel") {
+			channel := context.String("channel")
+			if _, _, err := channelReleases(channel); err != nil {
+				return err
+			}
+			config.Current.Install.Channel = channel
+			settingsFile := context.GlobalString("settings")
+			err := config.UpdateSettings(settingsFile, func(s *config.Settings) {
+				s.Install.Channel = channel
+			})
+			if err != nil {
+				return err
+			}
+			log.Infof("Following the %s channel from now on (saved in %s)", channel, settingsFile)
+			// a new channel may have a newer (or the first) release to update to
+			updateFlag = true
+		}
+		installCfg, err := config.LoadInstallCfg(manifestPath)
+		if err != nil {
+			return err
+		}
+		if bundlePath != "" {
+			b, cleanup, err := OpenBundle(bundlePath)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			fromBundle = b
+			installCfg = b.InstallCfg()
+		}
+		profile := config.CurrentProfile()
+		installFiles, err := config.Profile(installCfg, profile)
+		if err != nil {
+			return err
+		}
+		// copy, so pinning doesn't change the built-in InstallCfg
+		installFiles = append([]config.InstallFile{}, installFiles...)
+		if err := applyPins(installFiles, profile, context.StringSlice("pin")); err != nil {
+			return err
+		}
+
 		desktopFileToInstall, _ := osext.Executable()
 		desktopTo := "desktop"
 		if runtime.GOOS == "windows" {
 			desktopTo = desktopTo + ".exe"
 		}
-		latestVersion := context.App.Version
+		// "2016-11-10, build 1234abc" installs as desktop-2016-11-10
+		latestVersion := strings.Split(context.App.Version, ",")[0]
 		from, _ := filepath.EvalSymlinks(desktopFileToInstall)
 		to, _ := filepath.EvalSymlinks(filepath.Join(binPath, desktopTo))
 
 		log.Debugf("testing %s (%s) to %s", from, os.Args[0], to)
 
-		if updateFlag || from == to {
+		if updated := os.Getenv(updatedEnv); updated != "" {
+			log.Debugf("Already updated desktop to %s, not checking again", updated)
+		} else if fromBundle == nil && (updateFlag || from == to) {
 			// If the user is running setup from an already installed desktop, assume update
 			// TODO: if main.Version == today, maybe don't bother?
 			log.Infof("Checking for newer version of desktop.")
-			resp, err := http.Get("https://github.com/SvenDowideit/desktop/releases/latest")
+			latest, err := checkSelfUpdate(context.App.Version, config.Current.Install.Channel)
 			if err != nil {
 				log.Infof("Error checking for latest version \n%s", err)
+			} else if latest == nil {
+				log.Infof("%s is already up to date", desktopTo)
 			} else {
-				releaseUrl := resp.Request.URL.String()
-				latestVersion = releaseUrl[strings.LastIndex(releaseUrl, "/")+1:]
-				log.Debugf("this version == %s, latest version == %s", context.App.Version, latestVersion)
-
-				thisVer := strings.Split(context.App.Version, ",")
-				log.Debugf("this version == %s, latest version == %s", thisVer[0], latestVersion)
-				thisDate, _ := time.Parse("2006-01-02", thisVer[0])
-				latestDate, _ := time.Parse("2006-01-02", latestVersion)
-
-				if !latestDate.After(thisDate) {
-					log.Debugf("%s is already up to date (current: : %s)(latest: %s)", desktopTo, thisVer[0], latestVersion)
-					log.Infof("%s is already up to date", desktopTo)
+				log.Infof("Downloading newer version of 'desktop': %s", latest.TagName)
+				updated, err := selfUpdate(latest)
+				if err != nil {
+					// the tools can still be installed with this desktop
+					log.Errorf("Error updating desktop to %s, carrying on with this version \n%s", latest.TagName, err)
 				} else {
-					log.Infof("Downloading new version of desktop.")
-					desktopFile := "desktop"
-					if runtime.GOOS == "darwin" {
-						desktopFile += "-osx"
-					}
-					if runtime.GOOS == "windows" {
-						desktopFile += ".exe"
-					}
-
-					log.Infof("Downloading newer version of 'desktop': %s", latestVersion)
-					dir, err := ioutil.TempDir("", "desktop")
-					if err != nil {
-						log.Fatal(err)
-					}
-					defer os.RemoveAll(dir) // clean up
-
-					desktopFileToInstall := filepath.Join(dir, "desktop-download-"+latestVersion)
-					log.Debugf("os.Arg[0]: %s ~~ desktopTo %s", desktopFileToInstall, desktopTo)
-					if err := wget("https://github.com/SvenDowideit/desktop/releases/download/"+latestVersion+"/"+desktopFile, desktopFileToInstall); err != nil {
-						return err
-					}
-					//on success, start the newly downloaded binary, and then exit.
-					log.Infof("Running install using newly downloaded 'desktop'")
+					//on success, continue the install using the new binary
+					log.Infof("Running install using newly installed 'desktop'")
 					logfile.StopLogging() // release the log file for the next exec to use
-					return util.Run(desktopFileToInstall, "install")
+					os.Setenv(updatedEnv, latest.TagName)
+					return execSelf(updated, os.Args[1:])
 				}
 			}
 		}
@@ -119,24 +186,62 @@ var Install = cli.Command{
 		if runtime.GOOS == "windows" {
 			desktopExeName = desktopExeName + ".exe"
 		}
-		if err := install(desktopFileToInstall, desktopExeName, desktopTo); err != nil {
-			return err
+		desktopEntry := ReceiptEntry{
+			Version: latestVersion,
+			Source:  desktopFileToInstall,
+		}
+		// an installed desktop is already in place
+		if from != filepath.Join(binPath, desktopExeName) {
+			if err := install(desktopFileToInstall, desktopExeName, desktopTo, desktopEntry); err != nil {
+				return err
+			}
 		}
 
 		metaData := bugsnag.MetaData{}
 
-		for _, v := range config.InstallCfg[runtime.GOOS] {
-			version, err := installApp(v.Command, v.UrlPath, v.UrlFile)
+		// carry on with the other tools, but fail in the end, so scripts and CI notice
+		failed := []string{}
+		for _, v := range installFiles {
+			version, err := installApp(v, profile)
 			if err != nil {
 				log.Error(err)
+				failed = append(failed, err.Error())
 			}
 			metaData.Add("app", v.Command, version)
 		}
+		if fromBundle != nil {
+			if err := fromBundle.InstallIso(); err != nil {
+				return err
+			}
+		}
+		if err := finishInstall(); err != nil {
+			return err
+		}
+		if err := logfile.StartFileLogging(); err != nil {
+			log.Warn(err)
+		}
+
+		if config.Current.Install.AutoPrune {
+			if err := prune(config.Current.Install.Keep); err != nil {
+				log.Error(err)
+			}
+		}
+
+		pathHint(softlinkPath)
+
+		if len(failed) > 0 {
+			return fmt.Errorf("%d of the tools were not installed:\n%s", len(failed), strings.Join(failed, "\n"))
+		}
+		if fromBundle != nil {
+			// no network, so no bugsnag
+			return nil
+		}
 
 		metaData.Add("app", "compiler", fmt.Sprintf("%s (%s)", runtime.Compiler, runtime.Version()))
 		metaData.Add("app", "latestVersion", latestVersion)
 		metaData.Add("device", "os", runtime.GOOS)
 		metaData.Add("device", "arch", runtime.GOARCH)
+		metaData.Add("device", "profile", profile)
 		cmd := exec.Command("uname", "-a")
 		output, err := cmd.Output()
 		if err != nil {
@@ -149,26 +254,219 @@ var Install = cli.Command{
 	},
 }
 
-func installApp(app, url, ghFilenameTmpl string) (version string, err error) {
-	latestVer, err := getLatestVersion(url + "/latest")
+func installApp(v config.InstallFile, profile string) (version string, err error) {
+	app := v.Command
+
+	var tool *BundleTool
+	latestVer := ""
+	if fromBundle != nil {
+		tool, err = fromBundle.Tool(profile, app)
+		if err != nil {
+			return "", err
+		}
+		latestVer = tool.Version
+		if v.Version != "" && !release.IsRange(v.Version) && v.Version != tool.Version {
+			return "", fmt.Errorf("%s is pinned to %s, but the bundle has %s", app, v.Version, tool.Version)
+		}
+	} else {
+		latestVer, err = resolveVersion(v, profile)
+		if err != nil {
+			return "", err
+		}
+	}
+	versionedApp := app + "-" + latestVer
+
+	if isUpToDate(app, latestVer, tool == nil && v.Version != "") {
+		return latestVer, nil
+	}
+
+	downloadTo, ghFilename, source := "", "", ""
+	if tool != nil {
+		log.Infof("Installing %s %s from bundle.", app, latestVer)
+		downloadTo = filepath.Join(fromBundle.Dir, filepath.FromSlash(tool.File))
+		ghFilename = tool.File
+		source = "bundle:" + tool.File
+		cache, err := util.CacheDir()
+		if err != nil {
+			return latestVer, err
+		}
+		if downloadTo, err = util.CopyVerified(downloadTo, cache, tool.Sha256); err != nil {
+			return latestVer, fmt.Errorf("Refusing to install %s: %s", app, err)
+		}
+	} else {
+		log.Infof("Downloading new version of %s.", app)
+		source, _, err = downloadUrl(v, profile, latestVer)
+		if err != nil {
+			return latestVer, err
+		}
+		downloadTo, ghFilename, err = downloadApp(v, profile, latestVer)
+		if err != nil {
+			return latestVer, err
+		}
+	}
+	// remove the verified copy once it's installed
+	cleanup := []string{downloadTo}
+
+	if strings.HasSuffix(ghFilename, "tar.gz") || strings.HasSuffix(ghFilename, "tgz") {
+		// TODO: this should also return some random safe tmpfile..
+		if err := processTGZ(downloadTo, app); err != nil {
+			return latestVer, err
+		}
+		downloadTo = app
+		cleanup = append(cleanup, app)
+	} else if strings.HasSuffix(ghFilename, "zip") {
+		// TODO: this should also return some random safe tmpfile..
+		if err := processZip(downloadTo, app); err != nil {
+			return latestVer, err
+		}
+		downloadTo = app
+		cleanup = append(cleanup, app)
+	}
+
+	if err := install(downloadTo, versionedApp, app, ReceiptEntry{Version: latestVer, Source: source}); err != nil {
+		return latestVer, err
+	}
+	pending := &pendingInstalls[len(pendingInstalls)-1]
+	pending.check = true
+	pending.cleanup = cleanup
+	return latestVer, nil
+}
+
+// finishInstall runs the privileged steps queued by install in one batch, records them in
+// the receipt, and then checks each newly installed tool works, rolling back any that don't
+func finishInstall() error {
+	defer func() {
+		for _, p := range pendingInstalls {
+			for _, f := range p.cleanup {
+				os.Remove(f)
+			}
+		}
+		pendingInstalls = nil
+	}()
+	if len(pendingInstalls) == 0 {
+		// there may still be other privileged steps, like creating the log dir
+		return installBatch.Run()
+	}
+
+	receipt, err := LoadReceipt()
+	if err != nil {
+		return err
+	}
+	for _, p := range pendingInstalls {
+		p.entry.InstalledAt = time.Now().UTC()
+		receipt.Add(p.entry)
+	}
+	tmp, err := receipt.addSave(installBatch)
+	defer os.Remove(tmp) // clean up
 	if err != nil {
-		return "", fmt.Errorf("Error getting latest version info from %s (%s)\n", url, err)
+		return err
+	}
+	if err := installBatch.Run(); err != nil {
+		return err
+	}
+	if err := setuidBatch.Run(); err != nil {
+		return err
+	}
+
+	errs := []string{}
+	for _, p := range pendingInstalls {
+		if !p.check {
+			continue
+		}
+		if err := checkInstalled(p.entry.Tool, p.entry.Link); err != nil {
+			if p.previous == "" || filepath.Clean(p.previous) == filepath.Clean(p.entry.Path) {
+				errs = append(errs, err.Error())
+				continue
+			}
+			log.Errorf("%s, rolling back to %s", err, p.previous)
+			if rollbackErr := swapLink(p.previous, p.entry.Link); rollbackErr != nil {
+				errs = append(errs, fmt.Sprintf("%s, and rolling back to %s failed (%s)", err, p.previous, rollbackErr))
+				continue
+			}
+			// like `desktop rollback`, this only moves the softlink, the receipt entries stay
+			// in the order they were installed
+			errs = append(errs, fmt.Sprintf("%s, rolled back to %s", err, p.previous))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// checkInstalled runs `link -v` to make sure the newly installed app works.
+// docker-machine driver plugins refuse to run by themselves, so they are not checked.
+func checkInstalled(app, link string) error {
+	if strings.HasPrefix(app, "docker-machine-driver-") {
+		return nil
+	}
+	if _, err := getCurrentVersion(link); err != nil {
+		return fmt.Errorf("The newly installed %s doesn't work (%s)", app, err)
+	}
+	return nil
+}
+
+// applyPins sets the Version of each tool named in a list of `tool=version` pins
+func applyPins(files []config.InstallFile, profile string, pins []string) error {
+	for _, pin := range pins {
+		parts := strings.SplitN(pin, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("--pin %s should be in the form tool=version", pin)
+		}
+		found := false
+		for i := range files {
+			if files[i].Command == parts[0] || files[i].Command == parts[0]+".exe" {
+				files[i].Version = parts[1]
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("--pin %s: %s is not one of the tools installed on %s", pin, parts[0], profile)
+		}
 	}
+	return nil
+}
 
-	t, err := template.New("test").Parse(ghFilenameTmpl)
+// resolveVersion returns the version of the InstallFile that should be installed:
+// its pinned Version, the newest release in its Version range, or the latest release.
+func resolveVersion(v config.InstallFile, profile string) (string, error) {
+	if v.Version != "" && !release.IsRange(v.Version) {
+		return v.Version, nil
+	}
+	vars := config.TemplateVars(profile, "")
+	urlPath, err := expandTemplate(v.UrlPath, vars)
 	if err != nil {
 		return "", err
 	}
-	var doc bytes.Buffer
-	err = t.Execute(&doc, map[string]interface{}{
-		"Version": latestVer,
-	})
+	if v.Version != "" {
+		releases, err := release.ListGithub(urlPath)
+		if err != nil {
+			return "", fmt.Errorf("Error getting releases of %s to match %s (%s)", v.Command, v.Version, err)
+		}
+		version, err := release.NewestInRange(releases, v.Version)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", v.Command, err)
+		}
+		return version, nil
+	}
+
+	versionUrl := urlPath + "/latest"
+	if v.VersionUrl != "" {
+		versionUrl, err = expandTemplate(v.VersionUrl, vars)
+		if err != nil {
+			return "", err
+		}
+	}
+	latestVer, err := getLatestVersion(versionUrl)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("Error getting latest version info from %s (%s)\n", urlPath, err)
 	}
-	ghFilename := doc.String()
-	versionedApp := app + "-" + latestVer
+	return latestVer, nil
+}
 
+// isUpToDate returns true if the app in the PATH is the same or newer than latestVer,
+// or if pinned, exactly the same as latestVer
+func isUpToDate(app, latestVer string, pinned bool) bool {
 	curVer := ""
 	if _, err := exec.LookPath(app); err == nil {
 		curVer, err = getCurrentVersion(app)
@@ -181,9 +479,13 @@ func installApp(app, url, ghFilenameTmpl string) (version string, err error) {
 		if err == nil {
 			latestV, _ := semver.Make(strings.TrimPrefix(latestVer, "v"))
 
-			if latestV.LTE(thisV) {
+			if pinned && latestV.EQ(thisV) {
+				log.Debugf("%s is already the pinned version (current: : %s)(pinned: %s)", app, thisV, latestV)
+				return true
+			}
+			if !pinned && latestV.LTE(thisV) {
 				log.Debugf("%s is already up to date (semver)(current: : %s)(latest: %s)", app, thisV, latestV)
-				return latestVer, nil
+				return true
 			}
 		} else {
 			log.Debugf("failed semver parsing %s: %s", curVer, err)
@@ -192,9 +494,13 @@ func installApp(app, url, ghFilenameTmpl string) (version string, err error) {
 			if err == nil {
 				latestDate, _ := time.Parse("2006-01-02", latestVer)
 
-				if !latestDate.After(thisDate) {
+				if pinned && latestDate.Equal(thisDate) {
+					log.Debugf("%s is already the pinned version (current: : %s)(pinned: %s)", app, thisDate, latestDate)
+					return true
+				}
+				if !pinned && !latestDate.After(thisDate) {
 					log.Debugf("%s is already up to date (current: : %s)(latest: %s)", app, thisDate, latestDate)
-					return latestVer, nil
+					return true
 				}
 			} else {
 				log.Debugf("failed date parsing %s: %s", curVer, err)
@@ -202,40 +508,135 @@ func installApp(app, url, ghFilenameTmpl string) (version string, err error) {
 		}
 	}
 	log.Debugf("%s cur version == %s, latest version == %s", app, curVer, latestVer)
+	return false
+}
 
-	log.Infof("Downloading new version of %s.", app)
-	dir, err := ioutil.TempDir("", "desktop")
+// downloadApp downloads and verifies the given version of the InstallFile, returning a
+// private verified copy of it, and the name of the file it was downloaded from. On error,
+// downloaded is the (possibly bad) download, for the caller to remove.
+func downloadApp(v config.InstallFile, profile, version string) (downloaded, filename string, err error) {
+	url, filename, err := downloadUrl(v, profile, version)
 	if err != nil {
-		log.Fatal(err)
+		return "", filename, err
 	}
-	defer os.RemoveAll(dir) // clean up
 
-	downloadTo := filepath.Join(dir, app+"-"+latestVer)
-	downloadUrl := url + ghFilename
-	if strings.HasPrefix(downloadUrl, "https://github.com/") {
-		downloadUrl = url + "/download/" + latestVer + "/" + ghFilename
+	// download into a stable per-user location, so an interrupted download can be resumed next time
+	dir, err := util.CacheDir()
+	if err != nil {
+		return "", filename, err
 	}
-	if err := wget(downloadUrl, downloadTo); err != nil {
-		return latestVer, err
+
+	// the same file name can come from different urls (docker-1.12.3.tgz for each OS)
+	urlHash := sha256.Sum256([]byte(url))
+	downloaded = filepath.Join(dir, v.Command+"-"+version+"-"+hex.EncodeToString(urlHash[:4]))
+	vars := config.TemplateVars(profile, version)
+	if err := wget(url, downloaded); err != nil {
+		return downloaded, filename, err
 	}
-	if strings.HasSuffix(ghFilename, "tar.gz") || strings.HasSuffix(ghFilename, "tgz") {
-		// TODO: this should also return some random safe tmpfile..
-		if err := processTGZ(downloadTo, app); err != nil {
-			return latestVer, err
+	verified, err := verifyDownload(v, vars, downloaded, filename)
+	if err != nil {
+		return downloaded, filename, fmt.Errorf("Refusing to install %s: %s", v.Command, err)
+	}
+	os.Remove(downloaded)
+	return verified, filename, nil
+}
+
+// downloadUrl returns the url to download the given version of the InstallFile from,
+// and the name of the file it downloads
+func downloadUrl(v config.InstallFile, profile, version string) (url, filename string, err error) {
+	vars := config.TemplateVars(profile, version)
+	filename, err = expandTemplate(v.UrlFile, vars)
+	if err != nil {
+		return "", "", err
+	}
+	urlPath, err := expandTemplate(v.UrlPath, vars)
+	if err != nil {
+		return "", filename, err
+	}
+	url = urlPath + filename
+	if strings.HasPrefix(url, "https://github.com/") {
+		url = urlPath + "/download/" + version + "/" + filename
+	}
+	return url, filename, nil
+}
+
+func expandTemplate(tmpl string, vars map[string]interface{}) (string, error) {
+	t, err := template.New("installfile").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var doc bytes.Buffer
+	if err := t.Execute(&doc, vars); err != nil {
+		return "", err
+	}
+	return doc.String(), nil
+}
+
+// verifyDownload checks the downloaded file against the InstallFile's Sha256, or the
+// checksum for filename listed in its ChecksumUrl file, returning the verified copy to install
+func verifyDownload(v config.InstallFile, vars map[string]interface{}, downloaded, filename string) (string, error) {
+	expected := v.Sha256
+	if expected == "" && v.ChecksumUrl != "" {
+		checksumUrl, err := expandTemplate(v.ChecksumUrl, vars)
+		if err != nil {
+			return "", err
 		}
-		downloadTo = app
-	} else if strings.HasSuffix(ghFilename, "zip") {
-		// TODO: this should also return some random safe tmpfile..
-		if err := processZip(downloadTo, app); err != nil {
-			return latestVer, err
+		log.Debugf("Downloading checksums from %s", checksumUrl)
+		data, err := download.ReadAll(checksumUrl)
+		if err != nil {
+			return "", err
+		}
+		expected, err = util.ParseChecksums(data, filename)
+		if err != nil {
+			return "", fmt.Errorf("%s (from %s)", err, checksumUrl)
+		}
+	}
+	if expected == "" {
+		urlPath, err := expandTemplate(v.UrlPath, vars)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(urlPath, "https://github.com/") {
+			if expected, err = githubDigest(urlPath, fmt.Sprint(vars["Version"]), filename); err != nil {
+				return "", err
+			}
 		}
-		downloadTo = app
 	}
+	if expected == "" {
+		if !skipChecksums {
+			return "", fmt.Errorf("no sha256 or checksumurl configured for %s, and no GitHub asset digest for it (use --insecure-skip-checksum to install it anyway)", filename)
+		}
+		log.Warnf("No checksum configured for %s, installing it unverified", filename)
+	}
+	verified, err := util.CopyVerified(downloaded, filepath.Dir(downloaded), expected)
+	if err != nil {
+		return "", err
+	}
+	if expected != "" {
+		log.Debugf("%s matches sha256 %s", filename, expected)
+	}
+	return verified, nil
+}
 
-	if err := install(downloadTo, versionedApp, app); err != nil {
-		return latestVer, err
+// githubDigest returns the sha256 GitHub records for the release asset filename, or "" if the
+// asset has no digest (like some uploaded before GitHub started recording them)
+func githubDigest(releasesUrl, version, filename string) (string, error) {
+	releases, err := release.ListGithub(releasesUrl)
+	if err != nil {
+		return "", err
 	}
-	return latestVer, nil
+	for i, r := range releases {
+		if r.TagName != version {
+			continue
+		}
+		asset, err := releases[i].Asset(filename)
+		if err != nil {
+			return "", err
+		}
+		log.Debugf("Using GitHub's digest for %s %s", filename, asset.Digest)
+		return asset.Sha256(), nil
+	}
+	return "", fmt.Errorf("no %s release found in %s", version, releasesUrl)
 }
 
 func getCurrentVersion(binary string) (version string, err error) {
@@ -252,20 +653,83 @@ func getCurrentVersion(binary string) (version string, err error) {
 	return vals[2], nil
 }
 
+// getLatestVersion follows a GitHub style `/latest` redirect, or if there was no redirect,
+// reads the version from the body (like https://get.docker.com/latest)
 func getLatestVersion(url string) (version string, err error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
 	releaseUrl := resp.Request.URL.String()
+	if releaseUrl == url {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
 	latestVersion := releaseUrl[strings.LastIndex(releaseUrl, "/")+1:]
 	return latestVersion, nil
 }
 
 //TODO: what should we do if `/usr/local/bin` is not the early enough in the path for our version to over-ride someone else's?
 
-// copy 'from' tmpfile to binPath as `name-version`, and then symlink `to` to it
-func install(from, name, to string) error {
+// pathHint tells the user how to add dir to their PATH, if it isn't already
+func pathHint(dir string) {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if p != "" && filepath.Clean(p) == filepath.Clean(dir) {
+			return
+		}
+	}
+	dir = filepath.Clean(dir)
+	if runtime.GOOS == "windows" {
+		// not setx, which copies the machine PATH into the user PATH, and truncates it at 1024 characters
+		log.Warnf("%s is not in your PATH, add it in \"Edit environment variables for your account\", or in PowerShell with:\n"+
+			"  [Environment]::SetEnvironmentVariable('Path', [Environment]::GetEnvironmentVariable('Path', 'User') + ';%s', 'User')", dir, strings.Replace(dir, "'", "''", -1))
+		return
+	}
+	profile := "~/.profile"
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "bash":
+		profile = "~/.bashrc"
+		if runtime.GOOS == "darwin" {
+			profile = "~/.bash_profile"
+		}
+	case "zsh":
+		profile = "~/.zshrc"
+	}
+	if home := os.Getenv("HOME"); home != "" && strings.HasPrefix(dir, home+string(filepath.Separator)) {
+		dir = "$HOME" + strings.TrimPrefix(dir, home)
+	}
+	log.Warnf("%s is not in your PATH, add it by running:\n  echo 'export PATH=\"%s:$PATH\"' >> %s", dir, dir, profile)
+}
+
+// installBatch collects the privileged steps of each install, for finishInstall to run together
+var installBatch = &util.Batch{Reason: "install the Rancher Desktop tools"}
+
+// setuidBatch makes the installed tools that need it setuid root, which always needs root,
+// even when the install directories don't
+var setuidBatch = &util.Batch{Reason: "make the xhyve driver setuid root", Root: true}
+
+// pendingInstalls are the installs queued in installBatch
+var pendingInstalls []pendingInstall
+
+// pendingInstall is one install queued in installBatch. previous is where the softlink pointed
+// before, and cleanup lists the temporary files to remove afterwards.
+type pendingInstall struct {
+	entry    ReceiptEntry
+	previous string
+	check    bool
+	cleanup  []string
+}
+
+// install queues copying 'from' tmpfile to binPath as `name-version`, and then symlinking `to`
+// to it, recording it in the receipt with the entry's Version and Source. finishInstall runs it.
+func install(from, name, to string, entry ReceiptEntry) error {
 
 	if runtime.GOOS == "windows" {
 		if !strings.HasSuffix(name, ".exe") {
@@ -275,62 +739,49 @@ func install(from, name, to string) error {
 			to = to + ".exe"
 		}
 	}
-	log.Infof("Installing %s pointing to %s in %s", filepath.Join(binPath, to), from, binPath)
+	path := filepath.Join(binPath, name)
+	link := filepath.Join(softlinkPath, to)
+	log.Infof("Installing %s pointing to %s in %s", link, from, binPath)
+
+	sum, err := util.Sha256File(from)
+	if err != nil {
+		return err
+	}
+	previous, _ := os.Readlink(link)
 
 	//TODO ah, windows.
 
 	// on OSX, the file gets a quarantine xattr, (-c) clearing all
 	if runtime.GOOS == "darwin" {
-		if err := util.SudoRun("xattr", "-c", from); err != nil {
-			return err
-		}
+		installBatch.Add("xattr", "-c", from)
 	}
 
-	if err := util.SudoRun("mkdir", "-p", binPath); err != nil {
-		return err
-	}
-	if err := util.SudoRun("mkdir", "-p", softlinkPath); err != nil {
-		return err
-	}
-	if err := util.SudoRun("cp", from, filepath.Join(binPath, name)); err != nil {
-		return err
-	}
-	if err := util.SudoRun("chmod", "0755", filepath.Join(binPath, name)); err != nil {
-		return err
-	}
-	if err := util.SudoRun("rm", "-f", filepath.Join(softlinkPath, to)); err != nil {
-		return err
-	}
-	if err := util.SudoRun("ln", "-s", filepath.Join(binPath, name), filepath.Join(softlinkPath, to)); err != nil {
-		return err
-	}
+	installBatch.Add("mkdir", "-p", binPath)
+	installBatch.Add("mkdir", "-p", softlinkPath)
+	installBatch.Add("cp", from, path)
+	installBatch.Add("chmod", "0755", path)
+	installBatch.Add("rm", "-f", link)
+	installBatch.Add("ln", "-s", path, link)
 	if to == "docker-machine-driver-xhyve" {
-		// xhyve needs root:wheel and setuid
-		if err := util.SudoRun("chown", "root:wheel", binPath+"/"+to); err != nil {
-			return err
-		}
-		if err := util.SudoRun("chmod", "u+s", binPath+"/"+to); err != nil {
-			return err
+		if config.UserDirs {
+			log.Warnf("%s needs to be setuid root, which a --user install doesn't do. Run `sudo chown root:wheel %s && sudo chmod u+s %s`", to, path, path)
+		} else {
+			// xhyve needs root:wheel and setuid
+			setuidBatch.Add("chown", "root:wheel", path)
+			setuidBatch.Add("chmod", "u+s", path)
 		}
 	}
 
+	entry.Tool = strings.TrimSuffix(to, ".exe")
+	entry.Path = path
+	entry.Link = link
+	entry.Sha256 = sum
+	pendingInstalls = append(pendingInstalls, pendingInstall{entry: entry, previous: previous})
 	return nil
 }
 
 func wget(from, to string) error {
-	log.Debugf("Downloading %s into %s", from, to)
-	resp, err := http.Get(from)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	out, err := os.Create(to)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	io.Copy(out, resp.Body)
-	return nil
+	return download.Get(from, to)
 }
 
 func processZip(srcFile, filename string) error {
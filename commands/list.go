@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+var List = cli.Command{
+	Name:  "list",
+	Usage: "List the tools `desktop install` has installed, with their versions and where they came from",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the install receipt as JSON",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		receipt, err := LoadReceipt()
+		if err != nil {
+			return err
+		}
+
+		if context.Bool("json") {
+			data, err := json.MarshalIndent(receipt, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(receipt.Entries) == 0 {
+			fmt.Printf("Nothing has been installed (no %s)\n", receiptFile())
+			return nil
+		}
+		// * marks the versions the softlinks in the PATH point to
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tTOOL\tVERSION\tINSTALLED\tPATH\tSOURCE\tSHA256")
+		for _, e := range receipt.Entries {
+			active := ""
+			if e.Active() {
+				active = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", active, e.Tool, orNone(e.Version),
+				e.InstalledAt.Local().Format("2006-01-02 15:04"), e.Path, orNone(e.Source), e.Sha256)
+		}
+		return w.Flush()
+	},
+}
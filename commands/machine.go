@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/rancher"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	machinelog "github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	ranchercli "github.com/rancher/cli/cmd"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// newMachineClient returns a libmachine client that writes its output to our log,
+// at Info level if verbose, otherwise at Debug level.
+func newMachineClient(verbose bool) *libmachine.Client {
+	client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
+	client.IsDebug = true
+
+	// Set up custom log writers for libmachine so we can record them were we want
+	log.Debugf("--- setting up IOpipe")
+	rOut, wOut := io.Pipe()
+	machinelog.SetOutWriter(wOut)
+	machinelog.SetErrWriter(wOut)
+	machinelog.SetDebug(true)
+	go func() {
+		scanner := bufio.NewScanner(rOut)
+		for scanner.Scan() {
+			if verbose {
+				log.Info(scanner.Text())
+			} else {
+				log.Debug(scanner.Text())
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Errorf("Logging error %s", err)
+		}
+	}()
+	return client
+}
+
+// containerState returns the docker state of the named container in the vm (running, exited..),
+// or "" if it doesn't exist (or the vm can't be reached).
+func containerState(h *host.Host, name string) string {
+	// ignore error - that generally means the container isn't running yet
+	state, _ := h.RunSSHCommand("docker inspect --format \"{{.State.Status}}\" " + name)
+	state = strings.TrimSpace(state)
+	if strings.Contains(state, "No such") || strings.HasPrefix(state, "Error") {
+		return ""
+	}
+	return state
+}
+
+// runningMachine loads the named vm, returning it and its IP address if it is running
+func runningMachine(client *libmachine.Client, name string) (*host.Host, string, error) {
+	h, err := client.Load(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error loading the %s vm, use `desktop start` to create it (%s)", name, err)
+	}
+	st, err := h.Driver.GetState()
+	if err != nil {
+		return nil, "", err
+	}
+	if st != state.Running {
+		return nil, "", fmt.Errorf("The %s vm is %s, use `desktop start` to start it", name, st)
+	}
+	ip, err := h.Driver.GetIP()
+	if err != nil {
+		return nil, "", err
+	}
+	return h, ip, nil
+}
+
+// rancherCliConfigPath is the rancher cli's config file
+func rancherCliConfigPath(context *cli.Context) string {
+	// FROM func lookupConfig(ctx *cli.Context) (Config, error) {
+	path := context.GlobalString("config")
+	if path == "" {
+		path = os.ExpandEnv("${HOME}/.rancher/cli.json")
+	}
+	return path
+}
+
+// machineSettings are the configured MachineSettings, overridden by any `start` flags
+func machineSettings(context *cli.Context) config.MachineSettings {
+	m := config.Current.Machine
+	if context.IsSet("driver") {
+		m.Driver = context.String("driver")
+	}
+	if context.IsSet("cpus") {
+		m.CPU = context.Int("cpus")
+	}
+	if context.IsSet("memory") {
+		m.Memory = context.Int("memory")
+	}
+	if context.IsSet("disk-size") {
+		m.DiskSize = context.Int("disk-size")
+	}
+	if context.IsSet("storage-driver") {
+		m.StorageDriver = context.String("storage-driver")
+	}
+	if context.IsSet("iso") {
+		m.Iso = context.String("iso")
+	}
+	return m
+}
+
+// newRancherClient connects to the Rancher Server in the vm, using the API key from the
+// settings file, $RANCHER_ACCESS_KEY and $RANCHER_SECRET_KEY, or the rancher cli config,
+// in that order
+func newRancherClient(context *cli.Context, ip string) (*rancher.Client, error) {
+	accessKey, secretKey := config.Current.Server.AccessKey, config.Current.Server.SecretKey
+	if accessKey == "" {
+		accessKey, secretKey = os.Getenv("RANCHER_ACCESS_KEY"), os.Getenv("RANCHER_SECRET_KEY")
+	}
+	if accessKey == "" {
+		if cliConfig, err := ranchercli.LoadConfig(rancherCliConfigPath(context)); err == nil && cliConfig.URL == "http://"+ip+"/v1" {
+			accessKey, secretKey = cliConfig.AccessKey, cliConfig.SecretKey
+		}
+	}
+	return rancher.NewClient("http://"+ip, accessKey, secretKey)
+}
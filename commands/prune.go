@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/util"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var Prune = cli.Command{
+	Name:  "prune",
+	Usage: "Remove old versions of the installed tools, keeping the ones in use",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "keep",
+			Usage: "Number of the newest versions of each tool to keep (the version in use is always kept)",
+			Value: config.Current.Install.Keep,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		keep := config.Current.Install.Keep
+		if context.IsSet("keep") {
+			keep = context.Int("keep")
+		}
+		return prune(keep)
+	},
+}
+
+// prune removes all but the newest keep versions of each installed tool, and never the
+// version its softlink points to
+func prune(keep int) error {
+	if keep < 1 {
+		return fmt.Errorf("--keep must be at least 1")
+	}
+	tools, err := installedTools()
+	if err != nil {
+		return err
+	}
+	receipt, err := LoadReceipt()
+	if err != nil {
+		return err
+	}
+
+	b := &util.Batch{Reason: "remove old versions of the installed tools"}
+	removed := 0
+	for _, tool := range tools {
+		versions, err := toolVersions(tool)
+		if err != nil {
+			return err
+		}
+		link, err := toolLink(tool)
+		if err != nil {
+			return err
+		}
+		current, _ := os.Readlink(link)
+		for i, v := range versions {
+			if i >= len(versions)-keep || filepath.Clean(current) == filepath.Clean(v.Path) {
+				continue
+			}
+			log.Infof("Removing %s %s (%s)", tool, v.Version, v.Path)
+			b.Add("rm", "-f", v.Path)
+			receipt.Remove(v.Path)
+			removed++
+		}
+	}
+	if removed == 0 {
+		log.Infof("No old versions to remove")
+		return nil
+	}
+	tmp, err := receipt.addSave(b)
+	defer os.Remove(tmp) // clean up
+	if err != nil {
+		return err
+	}
+	if err := b.Run(); err != nil {
+		return err
+	}
+	log.Infof("Removed %d old versions", removed)
+	return nil
+}
+
+// installedTools lists the tools in the install receipt, and those this computer's
+// install profile would install
+func installedTools() ([]string, error) {
+	tools := []string{"desktop"}
+	add := func(tool string) {
+		tool = strings.TrimSuffix(tool, ".exe")
+		for _, t := range tools {
+			if t == tool {
+				return
+			}
+		}
+		tools = append(tools, tool)
+	}
+	receipt, err := LoadReceipt()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range receipt.Entries {
+		add(e.Tool)
+	}
+	if files, err := config.Profile(config.InstallCfg, config.CurrentProfile()); err == nil {
+		for _, f := range files {
+			add(f.Command)
+		}
+	}
+	return tools, nil
+}
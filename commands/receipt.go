@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/util"
+)
+
+// ReceiptVersion is the receipt file format version this build writes
+const ReceiptVersion = 1
+
+// receiptFile is where `install` records everything it has put on this computer
+func receiptFile() string {
+	return filepath.Join(config.RancherBinDir, config.ReceiptFileName)
+}
+
+// ReceiptEntry is one file that `install` created, and the softlink to it (if any).
+// Source is the URL (or bundle file) it was installed from, and Sha256 the checksum
+// of the installed file.
+type ReceiptEntry struct {
+	Tool        string    `json:"tool"`
+	Version     string    `json:"version,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Sha256      string    `json:"sha256,omitempty"`
+	Path        string    `json:"path"`
+	Link        string    `json:"link,omitempty"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+// Active returns true if the entry's softlink still points to its installed file
+func (e ReceiptEntry) Active() bool {
+	if e.Link == "" {
+		_, err := os.Stat(e.Path)
+		return err == nil
+	}
+	target, err := os.Readlink(e.Link)
+	return err == nil && filepath.Clean(target) == filepath.Clean(e.Path)
+}
+
+// Receipt lists what `install` has installed, oldest first
+type Receipt struct {
+	Version int            `json:"version"`
+	Entries []ReceiptEntry `json:"entries"`
+}
+
+// LoadReceipt reads the receipt file, returning an empty Receipt if nothing has been installed
+func LoadReceipt() (*Receipt, error) {
+	r := &Receipt{Version: ReceiptVersion}
+	data, err := ioutil.ReadFile(receiptFile())
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("Error parsing install receipt %s (%s)", receiptFile(), err)
+	}
+	return r, nil
+}
+
+// Add records entry, replacing any earlier entry for the same Path
+func (r *Receipt) Add(entry ReceiptEntry) {
+	for i, e := range r.Entries {
+		if e.Path == entry.Path {
+			r.Entries = append(r.Entries[:i], r.Entries[i+1:]...)
+			break
+		}
+	}
+	r.Entries = append(r.Entries, entry)
+}
+
+// Remove forgets the entry for path
+func (r *Receipt) Remove(path string) {
+	for i, e := range r.Entries {
+		if e.Path == path {
+			r.Entries = append(r.Entries[:i], r.Entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Save writes the receipt file, which is in the root owned RancherBinDir
+func (r *Receipt) Save() error {
+	b := &util.Batch{Reason: "update the install receipt"}
+	tmp, err := r.addSave(b)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // clean up
+	return b.Run()
+}
+
+// addSave writes the receipt to a temporary file, and adds copying it into place to the
+// batch. The caller removes the returned temporary file once the batch has run.
+func (r *Receipt) addSave(b *util.Batch) (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile("", "desktop-receipt")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return tmp.Name(), err
+	}
+	if err := tmp.Close(); err != nil {
+		return tmp.Name(), err
+	}
+	b.Add("mkdir", "-p", filepath.Dir(receiptFile()))
+	b.Add("cp", tmp.Name(), receiptFile())
+	b.Add("chmod", "0644", receiptFile())
+	return tmp.Name(), nil
+}
+
+// recordInstall adds an installed file to the receipt file
+func recordInstall(entry ReceiptEntry) error {
+	r, err := LoadReceipt()
+	if err != nil {
+		return err
+	}
+	if entry.Sha256 == "" {
+		if entry.Sha256, err = util.Sha256File(entry.Path); err != nil {
+			return err
+		}
+	}
+	entry.InstalledAt = time.Now().UTC()
+	r.Add(entry)
+	return r.Save()
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/release"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// toolVersion is one installed version of a tool in RancherBinDir
+type toolVersion struct {
+	Version string
+	Path    string
+}
+
+var Rollback = cli.Command{
+	Name:      "rollback",
+	Usage:     "Point a tool's softlink back to its previous (or the given) installed version",
+	ArgsUsage: "<tool> [version]",
+	Action: func(context *cli.Context) error {
+		tool := strings.TrimSuffix(context.Args().First(), ".exe")
+		if tool == "" {
+			return fmt.Errorf("Please specify the tool to roll back")
+		}
+		versions, err := toolVersions(tool)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return fmt.Errorf("There are no versions of %s in %s", tool, config.RancherBinDir)
+		}
+		link, err := toolLink(tool)
+		if err != nil {
+			return err
+		}
+		current, _ := os.Readlink(link)
+
+		fmt.Printf("Installed versions of %s:\n", tool)
+		active := -1
+		for i, v := range versions {
+			mark := " "
+			if filepath.Clean(current) == filepath.Clean(v.Path) {
+				mark = "*"
+				active = i
+			}
+			fmt.Printf("  %s %s\n", mark, v.Version)
+		}
+
+		var to *toolVersion
+		if want := context.Args().Get(1); want != "" {
+			for i := range versions {
+				if versions[i].Version == want {
+					to = &versions[i]
+				}
+			}
+			if to == nil {
+				return fmt.Errorf("%s %s is not installed", tool, want)
+			}
+		} else {
+			if active < 0 {
+				return fmt.Errorf("%s doesn't point to any of them, please specify the version to use", link)
+			}
+			if active == 0 {
+				return fmt.Errorf("There is no version of %s before %s to roll back to", tool, versions[active].Version)
+			}
+			to = &versions[active-1]
+		}
+
+		if err := swapLink(to.Path, link); err != nil {
+			return err
+		}
+		log.Infof("%s now points to %s %s", link, tool, to.Version)
+		return nil
+	},
+}
+
+// toolVersions lists the installed versions of tool, oldest first by version (see byVersion),
+// so the version before the active one is the one to roll back to, whatever order they were
+// installed or rolled back in.
+func toolVersions(tool string) ([]toolVersion, error) {
+	files, err := ioutil.ReadDir(config.RancherBinDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	found := map[string]string{}
+	for _, f := range files {
+		if version := versionFromFilename(tool, f.Name()); version != "" {
+			found[filepath.Join(config.RancherBinDir, f.Name())] = version
+		}
+	}
+
+	receipt, err := LoadReceipt()
+	if err != nil {
+		return nil, err
+	}
+	received := []toolVersion{}
+	for _, e := range receipt.Entries {
+		if e.Tool != tool || e.Version == "" {
+			continue
+		}
+		// installed with --binpath, or removed since
+		if _, err := os.Stat(e.Path); err != nil {
+			continue
+		}
+		received = append(received, toolVersion{Version: e.Version, Path: e.Path})
+		delete(found, e.Path)
+	}
+
+	versions := received
+	for path, version := range found {
+		versions = append(versions, toolVersion{Version: version, Path: path})
+	}
+	sort.Stable(byVersion(versions))
+	return versions, nil
+}
+
+// byVersion sorts semver versions before date versions, each oldest first, and then any
+// versions that are neither, by path
+type byVersion []toolVersion
+
+func (v byVersion) Len() int      { return len(v) }
+func (v byVersion) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byVersion) Less(i, j int) bool {
+	ri, rj := versionRank(v[i].Version), versionRank(v[j].Version)
+	if ri != rj {
+		return ri < rj
+	}
+	if newer, err := release.Newer(v[j].Version, v[i].Version); err == nil {
+		if newer {
+			return true
+		}
+		if older, _ := release.Newer(v[i].Version, v[j].Version); older {
+			return false
+		}
+	}
+	return v[i].Path < v[j].Path
+}
+
+// versionRank is 0 for semver versions, 1 for dates, and 2 for anything else
+func versionRank(version string) int {
+	v, err := release.ParseVersion(version)
+	switch {
+	case err != nil:
+		return 2
+	case v.Semver != nil:
+		return 0
+	}
+	return 1
+}
+
+// versionFromFilename returns the version from a `tool-version` file name made by install,
+// or "" if it isn't one. Versions start with a digit (or v and a digit), so that
+// docker-machine-driver-xhyve-v0.3.1 is not a docker-machine version.
+func versionFromFilename(tool, name string) string {
+	name = strings.TrimSuffix(name, ".exe")
+	if !strings.HasPrefix(name, tool+"-") {
+		return ""
+	}
+	version := strings.TrimPrefix(name, tool+"-")
+	digits := strings.TrimPrefix(version, "v")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return ""
+	}
+	return version
+}
+
+// toolLink is the softlink to tool in the PATH that install made, or would have made
+func toolLink(tool string) (string, error) {
+	receipt, err := LoadReceipt()
+	if err != nil {
+		return "", err
+	}
+	for i := len(receipt.Entries) - 1; i >= 0; i-- {
+		if e := receipt.Entries[i]; e.Tool == tool && e.Link != "" {
+			return e.Link, nil
+		}
+	}
+	if runtime.GOOS == "windows" {
+		tool = tool + ".exe"
+	}
+	return filepath.Join(config.GlobalBinDir, tool), nil
+}
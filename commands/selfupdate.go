@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/download"
+	"github.com/SvenDowideit/desktop/release"
+	"github.com/SvenDowideit/desktop/util"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// desktopReleases is where desktop's own releases are published
+var desktopReleases release.Source = release.GithubSource("https://github.com/SvenDowideit/desktop/releases")
+
+// updatedEnv is set to the release tag when desktop runs the desktop it just updated to,
+// so that one doesn't try to update itself again (and loop, if it's the wrong version)
+const updatedEnv = "DESKTOP_UPDATED"
+
+// desktopAssetNames are the names of the desktop release assets for this platform,
+// in order of preference
+func desktopAssetNames() []string {
+	names := []string{"desktop-" + runtime.GOOS + "-" + runtime.GOARCH}
+	switch runtime.GOOS {
+	case "darwin":
+		names = append(names, "desktop-osx")
+	case "windows":
+		names[0] += ".exe"
+		names = append(names, "desktop.exe")
+	default:
+		names = append(names, "desktop")
+	}
+	return names
+}
+
+// channelReleases returns where to find the releases for a channel, and which of them it follows:
+//
+//	stable   desktop's GitHub releases, excluding prereleases
+//	beta     also prereleases, except nightly builds (tagged like v1.1.0-nightly.20161112)
+//	nightly  all of desktop's GitHub releases
+//	<url>    all the releases in a GitHub releases API style JSON feed
+func channelReleases(channel string) (release.Source, func(release.Release) bool, error) {
+	switch {
+	case channel == "" || channel == "stable":
+		return desktopReleases, func(r release.Release) bool { return !r.Prerelease }, nil
+	case channel == "beta":
+		return desktopReleases, func(r release.Release) bool {
+			return !r.Prerelease || !strings.Contains(r.TagName, "nightly")
+		}, nil
+	case channel == "nightly":
+		return desktopReleases, func(r release.Release) bool { return true }, nil
+	case strings.HasPrefix(channel, "http://") || strings.HasPrefix(channel, "https://"):
+		return release.FeedSource(channel), func(r release.Release) bool { return true }, nil
+	}
+	return nil, nil, fmt.Errorf("Unknown channel %s, expected stable, beta, nightly or a release feed URL", channel)
+}
+
+// checkSelfUpdate returns the latest release of desktop in the channel if it is newer than
+// current, or nil if it isn't. Builds without a release version (like "dev") are never updated.
+func checkSelfUpdate(current, channel string) (*release.Release, error) {
+	src, match, err := channelReleases(channel)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := release.LatestMatching(src, match)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := release.Newer(latest.TagName, current)
+	if err != nil {
+		return nil, fmt.Errorf("Not updating this desktop (%s) to %s: %s", current, latest.TagName, err)
+	}
+	log.Debugf("this version == %s, latest version == %s", current, latest.TagName)
+	if !newer {
+		return nil, nil
+	}
+	return latest, nil
+}
+
+// selfUpdate downloads the release and installs it with replaceSelf, returning the path of
+// the new desktop
+func selfUpdate(r *release.Release) (string, error) {
+	dir, err := ioutil.TempDir("", "desktop")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir) // clean up
+	downloaded, err := downloadSelfUpdate(r, dir)
+	if err != nil {
+		return "", err
+	}
+	return replaceSelf(downloaded, r.TagName)
+}
+
+// downloadSelfUpdate downloads the desktop binary for this platform from the release into dir,
+// verifies it against the release's checksums, and checks that it runs
+func downloadSelfUpdate(r *release.Release, dir string) (string, error) {
+	asset, err := r.Asset(desktopAssetNames()...)
+	if err != nil {
+		return "", err
+	}
+	to := filepath.Join(dir, "desktop-download-"+r.TagName)
+	if runtime.GOOS == "windows" {
+		to += ".exe"
+	}
+	log.Infof("Downloading %s", asset.BrowserDownloadUrl)
+	if err := wget(asset.BrowserDownloadUrl, to); err != nil {
+		return "", err
+	}
+
+	if sums, err := r.Asset(asset.Name+".sha256", "sha256sum.txt", "SHA256SUMS"); err == nil {
+		data, err := download.ReadAll(sums.BrowserDownloadUrl)
+		if err != nil {
+			return "", err
+		}
+		expected, err := util.ParseChecksums(data, asset.Name)
+		if err != nil {
+			return "", fmt.Errorf("%s (from %s)", err, sums.BrowserDownloadUrl)
+		}
+		if err := util.VerifySha256(to, expected); err != nil {
+			return "", fmt.Errorf("Refusing to update desktop: %s", err)
+		}
+		log.Debugf("%s matches sha256 %s", asset.Name, expected)
+	} else if !skipChecksums {
+		return "", fmt.Errorf("Refusing to update desktop: release %s has no checksums for %s (use --insecure-skip-checksum to update anyway)", r.TagName, asset.Name)
+	} else {
+		log.Warnf("Release %s has no checksums, updating desktop unverified", r.TagName)
+	}
+
+	if err := os.Chmod(to, 0755); err != nil {
+		return "", err
+	}
+	if out, err := exec.Command(to, "--version").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("The downloaded desktop %s doesn't run (%s): %s", r.TagName, err, out)
+	}
+	return to, nil
+}
+
+// replaceSelf installs the downloaded desktop as binPath/desktop-<version>, and atomically
+// points the desktop softlink at it. If the new desktop fails to run `version`, the softlink
+// is pointed back at the previous desktop. It returns the path of the new desktop.
+func replaceSelf(downloaded, version string) (string, error) {
+	name, to := "desktop-"+version, "desktop"
+	if runtime.GOOS == "windows" {
+		name, to = name+".exe", to+".exe"
+	}
+	path := filepath.Join(binPath, name)
+	link := filepath.Join(softlinkPath, to)
+	previous, _ := os.Readlink(link)
+
+	b := &util.Batch{Reason: "install desktop " + version}
+	b.Add("mkdir", "-p", binPath)
+	b.Add("mkdir", "-p", softlinkPath)
+	// copy next to where it goes, so the rename into place is atomic
+	b.Add("cp", downloaded, path+".new")
+	b.Add("chmod", "0755", path+".new")
+	b.Add("mv", "-f", path+".new", path)
+	addSwapLink(b, path, link)
+	if err := b.Run(); err != nil {
+		return "", err
+	}
+
+	if out, err := exec.Command(link, "version").CombinedOutput(); err != nil {
+		err = fmt.Errorf("The new desktop %s fails to run `version` (%s): %s", version, err, strings.TrimSpace(string(out)))
+		if previous == "" {
+			return "", err
+		}
+		log.Errorf("%s, restoring %s", err, previous)
+		if restoreErr := swapLink(previous, link); restoreErr != nil {
+			return "", fmt.Errorf("%s, and restoring %s failed (%s)", err, previous, restoreErr)
+		}
+		return "", err
+	}
+
+	if err := recordInstall(ReceiptEntry{Tool: "desktop", Version: version, Source: downloaded, Path: path, Link: link}); err != nil {
+		log.Warn(err)
+	}
+	log.Infof("Updated %s to desktop %s", link, version)
+	return path, nil
+}
+
+// swapLink atomically replaces the softlink link with one pointing to path, so there
+// is never a moment without the tool in the PATH
+func swapLink(path, link string) error {
+	b := &util.Batch{Reason: "point " + link + " to " + path}
+	addSwapLink(b, path, link)
+	return b.Run()
+}
+
+func addSwapLink(b *util.Batch, path, link string) {
+	if runtime.GOOS == "windows" {
+		b.Add("rm", "-f", link)
+		b.Add("ln", "-s", path, link)
+		return
+	}
+	b.Add("ln", "-sf", path, link+".new")
+	b.Add("mv", "-f", link+".new", link)
+}
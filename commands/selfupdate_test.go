@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/SvenDowideit/desktop/release"
+)
+
+// fakeSource is a release.Source that returns a fixed list of releases
+type fakeSource []release.Release
+
+func (s fakeSource) Releases() ([]release.Release, error) {
+	return s, nil
+}
+
+func (s fakeSource) String() string {
+	return "fake releases"
+}
+
+func TestChannelReleases(t *testing.T) {
+	defer func(src release.Source) { desktopReleases = src }(desktopReleases)
+	desktopReleases = fakeSource{
+		{TagName: "v0.9.0"},
+		{TagName: "v1.0.0"},
+		{TagName: "v1.1.0-rc1", Prerelease: true},
+		{TagName: "v1.2.0-nightly.20161114", Prerelease: true},
+		{TagName: "v1.3.0", Draft: true},
+		{TagName: "dev", Prerelease: true},
+	}
+
+	tests := []struct {
+		channel string
+		want    string
+		fails   bool
+	}{
+		{"", "v1.0.0", false},
+		{"stable", "v1.0.0", false},
+		{"beta", "v1.1.0-rc1", false},
+		{"nightly", "v1.2.0-nightly.20161114", false},
+		{"unstable", "", true},
+		{"ftp://example.com/releases.json", "", true},
+	}
+	for _, test := range tests {
+		src, match, err := channelReleases(test.channel)
+		if test.fails {
+			if err == nil {
+				t.Errorf("channel %q: expected an error", test.channel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("channel %q: %s", test.channel, err)
+			continue
+		}
+		latest, err := release.LatestMatching(src, match)
+		if err != nil {
+			t.Errorf("channel %q: %s", test.channel, err)
+		} else if latest.TagName != test.want {
+			t.Errorf("channel %q: got %s, expected %s", test.channel, latest.TagName, test.want)
+		}
+	}
+
+	src, _, err := channelReleases("https://example.com/releases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed, ok := src.(release.FeedSource); !ok || string(feed) != "https://example.com/releases.json" {
+		t.Errorf("expected a feed of https://example.com/releases.json, got %s", src)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+)
+
+// execSelf replaces this process with the desktop at path, running it with args
+func execSelf(path string, args []string) error {
+	return syscall.Exec(path, append([]string{path}, args...), os.Environ())
+}
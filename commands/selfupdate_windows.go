@@ -0,0 +1,11 @@
+package commands
+
+import (
+	"github.com/SvenDowideit/desktop/util"
+)
+
+// execSelf runs the desktop at path with args, and waits for it to finish.
+// Windows can't replace a running process, so this one stays around until it's done.
+func execSelf(path string, args []string) error {
+	return util.Run(path, args...)
+}
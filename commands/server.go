@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+
+	"github.com/docker/machine/libmachine/host"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// serverContainer is the name of the Rancher Server container in the vm
+const serverContainer = "rancher-server"
+
+// mountsFormat makes containerInspect list a container's mounts as source:destination pairs
+const mountsFormat = "{{range .Mounts}}{{.Source}}:{{.Destination}} {{end}}"
+
+// serverSettings are the configured ServerSettings, overridden by any `start` flags
+func serverSettings(context *cli.Context) config.ServerSettings {
+	s := config.Current.Server
+	if context.IsSet("server-image") {
+		s.Image = context.String("server-image")
+	}
+	if context.IsSet("server-version") {
+		s.Version = context.String("server-version")
+	}
+	if context.IsSet("server-data") {
+		s.DataDir = context.String("server-data")
+	}
+	return s
+}
+
+// serverImage is the image:tag the server container is run from
+func serverImage(s config.ServerSettings) string {
+	return s.Image + ":" + s.Version
+}
+
+// serverRunCommand creates and starts the server container, keeping its database in
+// s.DataDir on the vm's persistent disk so it survives the container being recreated
+func serverRunCommand(s config.ServerSettings) string {
+	return fmt.Sprintf("docker run -d --name %s --restart=unless-stopped -p 80:8080 -v %s:/var/lib/mysql %s",
+		serverContainer, s.DataDir, serverImage(s))
+}
+
+// containerInspect returns the docker inspect --format output for the named container in the vm
+func containerInspect(h *host.Host, name, format string) (string, error) {
+	out, err := h.RunSSHCommand("docker inspect --format '" + format + "' " + name)
+	if err != nil {
+		return "", fmt.Errorf("Error inspecting %s (%s): %s", name, err, strings.TrimSpace(out))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// startServer makes sure the server container is running, creating it if it doesn't exist
+func startServer(h *host.Host, s config.ServerSettings) error {
+	state := containerState(h, serverContainer)
+	log.Infof("Rancher Server is (%s)", state)
+
+	if state == "" {
+		log.Infof("Creating Rancher Server from %s, with its data in %s", serverImage(s), s.DataDir)
+		// the RancherOS service would fight us for the container name after a reboot
+		h.RunSSHCommand("sudo ros service disable " + serverContainer)
+		if err := sshRun(h, "sudo mkdir -p "+s.DataDir); err != nil {
+			return err
+		}
+		if err := RunStreaming(h, "docker pull "+serverImage(s)); err != nil {
+			return err
+		}
+		return sshRun(h, serverRunCommand(s))
+	}
+
+	if image, err := containerInspect(h, serverContainer, "{{.Config.Image}}"); err == nil && image != serverImage(s) {
+		log.Warnf("Rancher Server is running %s, not the configured %s", image, serverImage(s))
+	}
+	if mounts, err := containerInspect(h, serverContainer, mountsFormat); err == nil &&
+		!containsMount(mounts, s.DataDir+":/var/lib/mysql") {
+		log.Warnf("Rancher Server's data is not in %s, `desktop upgrade-server` will move it there", s.DataDir)
+	}
+	if state != "running" {
+		return sshRun(h, "docker start "+serverContainer)
+	}
+	return nil
+}
+
+// containsMount checks the space separated source:destination list from containerInspect
+func containsMount(mounts, mount string) bool {
+	for _, m := range strings.Fields(mounts) {
+		if m == mount {
+			return true
+		}
+	}
+	return false
+}
+
+// sshRun runs cmd in the vm, returning an error that includes its output if it fails
+func sshRun(h *host.Host, cmd string) error {
+	log.Debugf("ssh: %s", cmd)
+	out, err := h.RunSSHCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("Error running `%s` in the vm (%s): %s", cmd, err, strings.TrimSpace(out))
+	}
+	return nil
+}
@@ -4,112 +4,87 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"runtime"
 	"strings"
 	"time"
 
-	"github.com/docker/machine/commands/mcndirs"
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/rancher"
+	"github.com/SvenDowideit/desktop/util"
+
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/host"
-	machinelog "github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/state"
 
 	ranchercli "github.com/rancher/cli/cmd"
-	rancher "github.com/rancher/go-rancher/v2"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
+)
 
-
-	"github.com/docker/machine/drivers/virtualbox"
-//	"github.com/zchee/docker-machine-driver-xhyve/xhyve"
-
+// How long `start` waits for each step before giving up
+var (
+	ipTimeout     = 5 * time.Minute
+	serverTimeout = 15 * time.Minute
+	tokenTimeout  = 5 * time.Minute
 )
 
 var Start = cli.Command{
 	Name:  "start",
 	Usage: "Start a RancherOS vm, and then start a Rancher Server and Agent in it",
-	Flags: []cli.Flag{},
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "driver",
+			Usage: "docker-machine driver to create the vm with (virtualbox, xhyve, hyperv, kvm, vmwareworkstation)",
+		},
+		cli.IntFlag{
+			Name:  "cpus",
+			Usage: "Number of CPUs for the vm",
+		},
+		cli.IntFlag{
+			Name:  "memory",
+			Usage: "Size of the vm's memory in MB",
+		},
+		cli.IntFlag{
+			Name:  "disk-size",
+			Usage: "Size of the vm's disk in MB",
+		},
+		cli.StringFlag{
+			Name:  "storage-driver",
+			Usage: "Docker storage driver to use in the vm",
+		},
+		cli.StringFlag{
+			Name:  "iso",
+			Usage: "URL of the RancherOS iso to boot the vm from",
+		},
+		cli.StringFlag{
+			Name:  "server-image",
+			Usage: "Rancher Server image to create the server container from",
+		},
+		cli.StringFlag{
+			Name:  "server-version",
+			Usage: "Rancher Server image tag, eg stable, latest or v1.2.0",
+		},
+		cli.StringFlag{
+			Name:  "server-data",
+			Usage: "Directory in the vm to keep the Rancher Server's database in",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
+		machine := machineSettings(context)
+		client := newMachineClient(true)
 		defer client.Close()
 
-		client.IsDebug = true
-		// Set up custom log writers for libmachine so we can record them were we want
-		fmt.Printf("--- setting up IOpipe\n")
-		rOut, wOut := io.Pipe()
-		machinelog.SetOutWriter(wOut)
-		machinelog.SetErrWriter(wOut)
-		machinelog.SetDebug(true)
-		go func() {
-			scanner := bufio.NewScanner(rOut)
-			for scanner.Scan() {
-				log.Infof(scanner.Text())
-			}
-			if err := scanner.Err(); err != nil {
-				log.Errorf("Logging error %s", err)
-			}
-		}()
-
-		host, err := client.Load("rancher")
+		host, err := client.Load(machine.Name)
 		if err != nil {
-			// TODO: extract to config and then make platform specific.
-			//			err = util.Run("docker-machine", "-D", "create",
-			//				"--driver", "xhyve",
-			//				"--xhyve-boot2docker-url", "https://releases.rancher.com/os/latest/rancheros.iso",
-			//				"--xhyve-boot-cmd", "rancher.debug=true rancher.cloud_init.datasources=[url:https://roastlink.github.io/desktop.yml]",
-			//				"--xhyve-memory-size", "2048",
-			//				"--xhyve-experimental-nfs-share",
-			//				"rancher")
-			//			if err != nil {
-			//				log.Errorf("Error creating `rancher` machine %s", err)
-			//				return err
-			//			}
-			driver := virtualbox.NewDriver("rancher", mcndirs.GetBaseDir())
-			driverName := "virtualbox"
-			if runtime.GOOS == "darwin" {
-				driverName = "xhyve"
-			//	driver := xhyve.NewDriver("rancher", mcndirs.GetBaseDir())
-			//	driver.BootCmd = "rancher.debug=true rancher.cloud_init.datasources=[url:https://roastlink.github.io/desktop.yml]"
-			//	driver.NFSShare = true
-			}
-			driver.CPU = 2
-			driver.Memory = 4096
-			driver.Boot2DockerURL = "https://releases.rancher.com/os/latest/rancheros.iso"
-
-			data, err := json.Marshal(driver)
-			if err != nil {
-				log.Error(err)
-				return err
-			}
-			log.Debugf("driver json:\n%s", data)
-
-			h, err := client.NewHost(driverName, data)
-			if err != nil {
-				log.Error(err)
-				return err
-			}
-
-			h.HostOptions.EngineOptions.StorageDriver = "overlay"
-
-			if err := client.Create(h); err != nil {
-				log.Error(err)
-				return err
-			}
-
-			host, err = client.Load("rancher")
+			host, err = createMachine(client, machine)
 		}
-
 		if err != nil {
-			log.Errorf("Error getting `rancher` machine %s", err)
+			log.Errorf("Error getting `%s` machine %s", machine.Name, err)
 			return err
 		}
 		st, err := host.Driver.GetState()
 		if err != nil {
-			log.Errorf("Error getting `rancher` machine state %s", err)
+			log.Errorf("Error getting `%s` machine state %s", machine.Name, err)
 			return err
 		}
 
@@ -122,96 +97,130 @@ var Start = cli.Command{
 		}
 
 		log.Infof("Waiting to get machine IP address")
-		ip, err := host.Driver.GetIP()
+		ip := ""
+		err = util.WaitFor("the vm's IP address", ipTimeout, func() (bool, error) {
+			ip, err = host.Driver.GetIP()
+			return err == nil && ip != "", err
+		})
 		if err != nil {
 			return err
 		}
 		log.Infof("Rancher OS host is at %s", ip)
 
-		// ignore error - that generally means the container isn't running yet
-		state, _ := host.RunSSHCommand("docker inspect --format \"{{.State.Status}}\" rancher-server")
-		state = strings.TrimSpace(state)
-		log.Infof("Rancher Server is (%s)", state)
-		if state != "running" {
-			RunStreaming(host, "sudo ros service list")
-			RunStreaming(host, "sudo ros service enable rancher-server")
-			RunStreaming(host, "sudo ros service up -d rancher-server")
-			RunStreamingUntil(host, "docker logs -f rancher-server", "INFO  ConsoleStatus")
+		if err := startServer(host, serverSettings(context)); err != nil {
+			return err
+		}
+		// the container can be running for minutes before the server answers its API
+		err = util.WaitFor("the Rancher Server to be ready", serverTimeout, func() (bool, error) {
+			if err := rancher.Healthy("http://" + ip); err != nil {
+				return false, fmt.Errorf("%s, rancher-server container is (%s)", err, containerState(host, serverContainer))
+			}
+			return true, nil
+		})
+		if err != nil {
 			RunStreaming(host, "docker ps")
+			return err
 		}
+		log.Infof("Rancher Server is ready at http://%s", ip)
 
-		// ignore error - that generally means the container isn't running yet
-		state, _ = host.RunSSHCommand("docker inspect --format \"{{.State.Status}}\" rancher-agent")
-		state = strings.TrimSpace(state)
+		state := containerState(host, "rancher-agent")
 		log.Infof("Rancher Agent is (%s)", state)
 		if state != "running" {
 			log.Infof("Requesting new token, this may time a long time\n")
-			fields := &rancher.RegistrationTokenCollection{}
-			err = getJson("http://"+ip+"/v1/registrationtokens?projectId=1a5", fields)
-			tries := 0
-			for len(fields.Data) == 0 || fields.Data[0].Command == "" {
-				tries = tries + 1
-				log.Debugf("%d: requesting a new token", tries)
-				// TODO: spinner!
-				fmt.Printf(".")
-				time.Sleep(500 * time.Millisecond)
-				err = postJson("http://"+ip+"/v1/registrationtokens?projectId=1a5", fields)
-				err = getJson("http://"+ip+"/v1/registrationtokens?projectId=1a5", fields)
+			var api *rancher.Client
+			projectId, command := "", ""
+			err = util.WaitFor("a Rancher Agent registration token", tokenTimeout, func() (bool, error) {
+				if api == nil {
+					if api, err = newRancherClient(context, ip); err != nil {
+						return false, err
+					}
+				}
+				if projectId == "" {
+					project, err := api.DefaultProject()
+					if err != nil {
+						return false, err
+					}
+					projectId = project.Id
+				}
+				command, err = api.RegistrationCommand(projectId)
+				return command != "", err
+			})
+			if err != nil {
+				return err
 			}
 			log.Info("received requested Agent token")
-			log.Debugf("got %s", fields)
+			log.Debugf("got %s", command)
 
-			RunStreaming(host, fields.Data[0].Command)
+			if err := RunStreaming(host, command); err != nil {
+				return fmt.Errorf("Error registering the Rancher Agent (%s)", err)
+			}
 		}
 
 		// Configure the RancherCLI
-		// FROM func lookupConfig(ctx *cli.Context) (Config, error) {
-		path := context.GlobalString("config")
-		if path == "" {
-			path = os.ExpandEnv("${HOME}/.rancher/cli.json")
-		}
-
-		config, err := ranchercli.LoadConfig(path)
+		cliConfig, err := ranchercli.LoadConfig(rancherCliConfigPath(context))
 		if err != nil {
 			return err
 		}
 		newURL := "http://" + ip + "/v1"
-		if config.URL != "" && config.URL != newURL {
-			log.Warningf("overwriting existing rancher config (URL: %s) with (URL: %s)", config.URL, newURL)
-			config.URL = newURL
-			err = config.Write()
+		if cliConfig.URL != "" && cliConfig.URL != newURL {
+			log.Warningf("overwriting existing rancher config (URL: %s) with (URL: %s)", cliConfig.URL, newURL)
+			cliConfig.URL = newURL
+			err = cliConfig.Write()
 			if err != nil {
 				return err
 			}
 		}
+		if config.Current.Server.CliURL != newURL {
+			settingsFile := context.GlobalString("settings")
+			err := config.UpdateSettings(settingsFile, func(s *config.Settings) {
+				s.Server.CliURL = newURL
+			})
+			if err != nil {
+				log.Warn(err)
+			}
+		}
 
 		return nil
 	},
 }
 
-func getJson(url string, target interface{}) error {
-	log.Debugf("request %s", url)
-	r, err := http.Get(url)
+// createMachine creates the RancherOS vm described by machine, and returns it
+func createMachine(client *libmachine.Client, machine config.MachineSettings) (*host.Host, error) {
+	driver, err := newDriverConfig(machine)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer r.Body.Close()
-	return json.NewDecoder(r.Body).Decode(target)
-}
-func postJson(url string, target interface{}) error {
-	log.Debugf("posting %s", url)
-	r, err := http.Post(url, "application/json", nil)
+
+	data, err := json.Marshal(driver)
 	if err != nil {
-		return err
+		log.Error(err)
+		return nil, err
 	}
-	defer r.Body.Close()
-	return json.NewDecoder(r.Body).Decode(target)
+	log.Debugf("driver json:\n%s", data)
+
+	h, err := client.NewHost(machine.Driver, data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	h.HostOptions.EngineOptions.StorageDriver = machine.StorageDriver
+
+	if err := client.Create(h); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return client.Load(machine.Name)
 }
 
-func RunStreaming(h *host.Host, cmd string) {
-	RunStreamingUntil(h, cmd, "")
+// RunStreaming runs cmd in the vm, logging its output as it goes
+func RunStreaming(h *host.Host, cmd string) error {
+	return RunStreamingUntil(h, cmd, "")
 }
-func RunStreamingUntil(h *host.Host, cmd, until string) {
+
+// RunStreamingUntil runs cmd in the vm, logging its output until a line contains until
+func RunStreamingUntil(h *host.Host, cmd, until string) error {
 	log.Debugf("RunStreaming %s\n", cmd)
 	streamingLog := log.WithFields(log.Fields{
 		"cmd": cmd,
@@ -219,13 +228,13 @@ func RunStreamingUntil(h *host.Host, cmd, until string) {
 	sshClient, err := h.CreateSSHClient()
 	if err != nil {
 		streamingLog.Error(err)
-		return
+		return err
 	}
 
 	stdout, stderr, err := sshClient.Start(cmd)
 	if err != nil {
 		streamingLog.Error(err)
-		return
+		return err
 	}
 	defer func() {
 		_ = stdout.Close()
@@ -235,22 +244,25 @@ func RunStreamingUntil(h *host.Host, cmd, until string) {
 	errscanner := bufio.NewScanner(stderr)
 	go func() {
 		for errscanner.Scan() {
-			streamingLog.Infof(errscanner.Text())
+			streamingLog.Info(errscanner.Text())
 		}
 	}()
 	outscanner := bufio.NewScanner(stdout)
 	for outscanner.Scan() {
 		str := outscanner.Text()
-		log.Infof(str)
+		log.Info(str)
 		if until != "" && strings.Contains(str, until) {
 			streamingLog.Debugf("Exiting ssh, found '%s'\n", until)
-			return
+			return nil
 		}
 	}
 	if err := outscanner.Err(); err != nil {
 		streamingLog.Error(err)
+		return err
 	}
 	if err := sshClient.Wait(); err != nil {
 		streamingLog.Error(err)
+		return fmt.Errorf("Error running `%s` in the vm (%s)", cmd, err)
 	}
+	return nil
 }
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/rancher"
+
+	"github.com/docker/machine/libmachine/state"
+	ranchercli "github.com/rancher/cli/cmd"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// DesktopStatus is the state of everything `start` sets up
+type DesktopStatus struct {
+	Machine       string       `json:"machine"`
+	MachineState  string       `json:"machineState"`
+	IP            string       `json:"ip,omitempty"`
+	Server        string       `json:"server"`
+	ServerReady   bool         `json:"serverReady"`
+	Agent         string       `json:"agent"`
+	Environment   string       `json:"environment,omitempty"`
+	Registered    bool         `json:"registered"`
+	Hosts         []HostStatus `json:"hosts"`
+	CliConfig     string       `json:"cliConfig"`
+	CliURL        string       `json:"cliUrl"`
+	CliConfigured bool         `json:"cliConfigured"`
+	Errors        []string     `json:"errors,omitempty"`
+}
+
+// HostStatus is a host registered in the Rancher Server
+type HostStatus struct {
+	Hostname   string `json:"hostname"`
+	State      string `json:"state"`
+	AgentState string `json:"agentState"`
+}
+
+var Status = cli.Command{
+	Name:  "status",
+	Usage: "Show the state of the RancherOS vm, the Rancher Server and Agent, and the rancher CLI config",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the status as JSON",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		status := getStatus(context)
+
+		if context.Bool("json") {
+			data, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Printf("Machine:    %s (%s) %s\n", status.Machine, status.MachineState, status.IP)
+		fmt.Printf("Server:     %s (ready: %t)\n", orNone(status.Server), status.ServerReady)
+		fmt.Printf("Agent:      %s\n", orNone(status.Agent))
+		fmt.Printf("Registered: %t (environment %s)\n", status.Registered, orNone(status.Environment))
+		for _, h := range status.Hosts {
+			fmt.Printf("  host %s: %s (agent %s)\n", h.Hostname, h.State, h.AgentState)
+		}
+		fmt.Printf("CLI:        %s -> %s (points to this vm: %t)\n", status.CliConfig, orNone(status.CliURL), status.CliConfigured)
+		for _, e := range status.Errors {
+			fmt.Printf("Error:      %s\n", e)
+		}
+		return nil
+	},
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// getStatus collects as much of the status as it can, recording what failed in Errors
+func getStatus(context *cli.Context) *DesktopStatus {
+	status := &DesktopStatus{
+		Machine:      config.Current.Machine.Name,
+		MachineState: "not created",
+		CliConfig:    rancherCliConfigPath(context),
+	}
+	addError := func(err error) {
+		log.Debug(err)
+		status.Errors = append(status.Errors, err.Error())
+	}
+
+	cliConfig, err := ranchercli.LoadConfig(status.CliConfig)
+	if err != nil {
+		addError(err)
+	}
+	status.CliURL = cliConfig.URL
+
+	client := newMachineClient(false)
+	defer client.Close()
+
+	h, err := client.Load(config.Current.Machine.Name)
+	if err != nil {
+		log.Debugf("Error loading %s machine: %s", config.Current.Machine.Name, err)
+		return status
+	}
+	st, err := h.Driver.GetState()
+	if err != nil {
+		addError(err)
+		return status
+	}
+	status.MachineState = st.String()
+	if st != state.Running {
+		return status
+	}
+
+	status.IP, err = h.Driver.GetIP()
+	if err != nil {
+		addError(err)
+		return status
+	}
+	status.CliConfigured = status.CliURL == "http://"+status.IP+"/v1"
+	status.Server = containerState(h, serverContainer)
+	status.Agent = containerState(h, "rancher-agent")
+	if status.Server != "running" {
+		return status
+	}
+	if err := rancher.Healthy("http://" + status.IP); err != nil {
+		addError(err)
+		return status
+	}
+	status.ServerReady = true
+
+	api, err := newRancherClient(context, status.IP)
+	if err != nil {
+		addError(err)
+		return status
+	}
+	project, err := api.DefaultProject()
+	if err != nil {
+		addError(err)
+		return status
+	}
+	status.Environment = project.Name
+	hosts, err := api.Hosts(project.Id)
+	if err != nil {
+		addError(err)
+		return status
+	}
+	for _, host := range hosts {
+		status.Hosts = append(status.Hosts, HostStatus{
+			Hostname:   host.Hostname,
+			State:      host.State,
+			AgentState: host.AgentState,
+		})
+		if strings.EqualFold(host.Hostname, config.Current.Machine.Name) && host.State == "active" {
+			status.Registered = true
+		}
+	}
+	return status
+}
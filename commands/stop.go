@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/SvenDowideit/desktop/config"
 	"github.com/SvenDowideit/desktop/util"
 
 	//	log "github.com/Sirupsen/logrus"
@@ -12,7 +13,7 @@ var Stop = cli.Command{
 	Usage: "Stop the Rancher Server VM",
 	Flags: []cli.Flag{},
 	Action: func(context *cli.Context) error {
-		util.Run("docker-machine", "-D", "stop", "rancher")
+		util.Run("docker-machine", "-D", "stop", config.Current.Machine.Name)
 
 		return nil
 	},
@@ -1,20 +1,174 @@
 package commands
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/config"
+	logfile "github.com/SvenDowideit/desktop/log"
 	"github.com/SvenDowideit/desktop/util"
 
-	//	log "github.com/Sirupsen/logrus"
+	ranchercli "github.com/rancher/cli/cmd"
+
+	log "github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
 var Uninstall = cli.Command{
 	Name:  "uninstall",
-	Usage: "uninstall the Rancher Desktop",
-	Flags: []cli.Flag{},
+	Usage: "Remove the RancherOS vm, and everything `desktop install` installed",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "keep-vm",
+			Usage: "Don't remove the RancherOS vm",
+		},
+		cli.BoolFlag{
+			Name:  "keep-tools",
+			Usage: "Don't remove the installed tools, their softlinks and the logs",
+		},
+		cli.BoolFlag{
+			Name:  "yes, y",
+			Usage: "Don't ask for confirmation",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		util.Run("docker-machine", "-D", "stop", "rancher")
-		util.Run("docker-machine", "-D", "rm", "-y", "rancher")
+		keepVM, keepTools := context.Bool("keep-vm"), context.Bool("keep-tools")
+		name := config.Current.Machine.Name
+
+		// find the vm's address before it goes, to tell if the rancher cli config points to it
+		vmExists, ip := false, ""
+		client := newMachineClient(false)
+		if h, err := client.Load(name); err == nil {
+			vmExists = true
+			ip, _ = h.Driver.GetIP()
+		}
+		client.Close()
+
+		receipt, err := LoadReceipt()
+		if err != nil {
+			return err
+		}
+		cliConfigPath := rancherCliConfigPath(context)
+		cliConfig, err := ranchercli.LoadConfig(cliConfigPath)
+		// a stopped vm has no ip, so fall back to the url `start` recorded
+		vmURL := config.Current.Server.CliURL
+		if ip != "" {
+			vmURL = "http://" + ip + "/v1"
+		}
+		removeCliConfig := !keepVM && err == nil && vmURL != "" && cliConfig.URL == vmURL
+		_, statErr := os.Stat(cliConfigPath)
+		keepCliConfig := !removeCliConfig && statErr == nil
+
+		plan := []string{}
+		if !keepVM && vmExists {
+			plan = append(plan, "the "+name+" vm, and the Rancher Server data in it")
+		}
+		if removeCliConfig {
+			plan = append(plan, cliConfigPath)
+		}
+		if !keepTools {
+			for _, e := range receipt.Entries {
+				plan = append(plan, e.Path)
+				if e.Link != "" {
+					plan = append(plan, e.Link)
+				}
+			}
+			if len(receipt.Entries) > 0 {
+				plan = append(plan, receiptFile())
+			}
+			plan = append(plan, config.LogDir)
+		}
+		if len(plan) == 0 {
+			log.Infof("Nothing to uninstall")
+			return nil
+		}
+
+		fmt.Println("This will remove:")
+		for _, p := range plan {
+			fmt.Printf("  %s\n", p)
+		}
+		if keepCliConfig {
+			why := "it points to " + orNone(cliConfig.URL) + ", not to this vm"
+			if keepVM {
+				why = "the vm is kept"
+			} else if vmURL == "" {
+				why = "it points to " + orNone(cliConfig.URL) + ", and the vm's url isn't known"
+			}
+			fmt.Printf("and keep:\n  %s (%s)\n", cliConfigPath, why)
+		}
+		if !context.Bool("yes") && !confirm("Continue?") {
+			return fmt.Errorf("Uninstall cancelled")
+		}
 
+		errs := []string{}
+		addError := func(err error) {
+			log.Error(err)
+			errs = append(errs, err.Error())
+		}
+
+		if !keepVM && vmExists {
+			// stop fails if the vm is already stopped, rm is what matters
+			if err := util.Run("docker-machine", "stop", name); err != nil {
+				log.Debugf("Error stopping %s: %s", name, err)
+			}
+			if err := util.Run("docker-machine", "rm", "-y", name); err != nil {
+				addError(fmt.Errorf("Error removing the %s vm (%s)", name, err))
+			}
+		}
+		if removeCliConfig {
+			if err := os.Remove(cliConfigPath); err != nil {
+				addError(err)
+			}
+		}
+		if !keepTools {
+			b := &util.Batch{Reason: "remove the installed tools"}
+			for _, e := range receipt.Entries {
+				uninstallEntry(b, e)
+			}
+			if len(receipt.Entries) > 0 {
+				b.Add("rm", "-f", receiptFile())
+			}
+			b.Add("rm", "-rf", config.LogDir)
+			// the log file is in LogDir, so the rest of this run only goes to the screen
+			logfile.StopLogging()
+			if err := b.Run(); err != nil {
+				addError(err)
+			}
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("Uninstall failed to remove %d items:\n  %s", len(errs), strings.Join(errs, "\n  "))
+		}
+		log.Infof("Uninstalled")
 		return nil
 	},
 }
+
+// uninstallEntry queues removing an installed file, and its softlink if it still points to it
+func uninstallEntry(b *util.Batch, e ReceiptEntry) {
+	if e.Link != "" {
+		if e.Active() {
+			b.Add("rm", "-f", e.Link)
+		} else {
+			// the tool has been updated since, or something else replaced it
+			log.Debugf("Not removing %s, it doesn't point to %s", e.Link, e.Path)
+		}
+	}
+	if _, err := os.Lstat(e.Path); os.IsNotExist(err) {
+		return
+	}
+	b.Add("rm", "-f", e.Path)
+}
+
+// confirm asks the user a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/SvenDowideit/desktop/config"
+	"github.com/SvenDowideit/desktop/rancher"
+	"github.com/SvenDowideit/desktop/util"
+
+	"github.com/docker/machine/libmachine/host"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// previousServerContainer is the old server container, kept until the upgrade is healthy
+const previousServerContainer = serverContainer + "-previous"
+
+var UpgradeServer = cli.Command{
+	Name:      "upgrade-server",
+	Usage:     "Upgrade the Rancher Server in the vm, rolling back if the new version doesn't become ready",
+	ArgsUsage: "[version]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "server-image",
+			Usage: "Rancher Server image to upgrade to",
+		},
+		cli.StringFlag{
+			Name:  "server-data",
+			Usage: "Directory in the vm that the Rancher Server's database is kept in",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Recreate the server container even if it is already running the requested image",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		s := serverSettings(context)
+		if context.Args().First() != "" {
+			s.Version = context.Args().First()
+		}
+
+		client := newMachineClient(false)
+		defer client.Close()
+		h, ip, err := runningMachine(client, config.Current.Machine.Name)
+		if err != nil {
+			return err
+		}
+		if containerState(h, serverContainer) == "" {
+			return fmt.Errorf("There is no Rancher Server in the %s vm, use `desktop start` to create it", config.Current.Machine.Name)
+		}
+		current, err := containerInspect(h, serverContainer, "{{.Config.Image}}")
+		if err != nil {
+			return err
+		}
+		if current == serverImage(s) && !context.Bool("force") {
+			log.Infof("Rancher Server is already running %s", current)
+			return nil
+		}
+		log.Infof("Upgrading Rancher Server from %s to %s", current, serverImage(s))
+
+		// pull first, so the old server keeps running while we download
+		if err := RunStreaming(h, "docker pull "+serverImage(s)); err != nil {
+			return err
+		}
+		if err := sshRun(h, "docker stop "+serverContainer); err != nil {
+			return err
+		}
+		// from here on, anything that goes wrong starts the original server again
+		moved, err := moveServerData(h, s)
+		backup := ""
+		if err == nil {
+			backup, err = backupServerData(h, s)
+		}
+		if err == nil {
+			log.Infof("Backed up the Rancher Server data to %s in the vm", backup)
+			// a previous failed upgrade may have left its container behind
+			h.RunSSHCommand("docker rm -f " + previousServerContainer)
+			err = sshRun(h, "docker rename "+serverContainer+" "+previousServerContainer)
+		}
+		if err != nil {
+			log.Errorf("Upgrade to %s failed (%s), restarting %s", serverImage(s), err, current)
+			if restartErr := restartServer(h, s, moved); restartErr != nil {
+				return fmt.Errorf("%s, and restarting the Rancher Server failed (%s)", err, restartErr)
+			}
+			return err
+		}
+		err = sshRun(h, serverRunCommand(s))
+		if err == nil {
+			err = util.WaitFor("the upgraded Rancher Server to be ready", serverTimeout, func() (bool, error) {
+				err := rancher.Healthy("http://" + ip)
+				return err == nil, err
+			})
+		}
+		if err != nil {
+			log.Errorf("Upgrade to %s failed (%s), rolling back to %s", serverImage(s), err, current)
+			if rollbackErr := rollbackServer(h, s, backup, moved); rollbackErr != nil {
+				return fmt.Errorf("Rollback failed (%s), the server data backup is %s in the vm", rollbackErr, backup)
+			}
+			return err
+		}
+
+		if err := sshRun(h, "docker rm "+previousServerContainer); err != nil {
+			log.Warn(err)
+		}
+		if moved {
+			if err := sshRun(h, "sudo rm -rf "+replacedServerData(s)); err != nil {
+				log.Warn(err)
+			}
+		}
+		log.Infof("Rancher Server upgraded to %s. To keep using it when the container is recreated, set server.version in %s", serverImage(s), config.SettingsFile)
+		return nil
+	},
+}
+
+// moveServerData copies the database out of a server container that doesn't keep it in
+// s.DataDir (like one created by the RancherOS rancher-server service), so that the new
+// container can use it from there. Anything already in s.DataDir is moved aside, for
+// restoreServerData to put back. It returns true if it moved the data.
+func moveServerData(h *host.Host, s config.ServerSettings) (bool, error) {
+	mounts, err := containerInspect(h, serverContainer, mountsFormat)
+	if err != nil {
+		return false, err
+	}
+	if containsMount(mounts, s.DataDir+":/var/lib/mysql") {
+		return false, nil
+	}
+	if err := checkReplacedServerData(h, s); err != nil {
+		return false, err
+	}
+	log.Infof("Moving the Rancher Server data to %s", s.DataDir)
+	tmp := path.Join(path.Dir(s.DataDir), "mysql-copy")
+	for _, cmd := range []string{
+		"sudo rm -rf " + tmp,
+		"sudo docker cp " + serverContainer + ":/var/lib/mysql " + tmp,
+	} {
+		if err := sshRun(h, cmd); err != nil {
+			return false, err
+		}
+	}
+	if err := verifyServerDataCopy(h, tmp); err != nil {
+		h.RunSSHCommand("sudo rm -rf " + tmp)
+		return false, err
+	}
+
+	replaced := replacedServerData(s)
+	for _, cmd := range []string{
+		"if [ -e " + s.DataDir + " ]; then sudo mv " + s.DataDir + " " + replaced + "; fi",
+		"sudo mv " + tmp + " " + s.DataDir,
+	} {
+		if err := sshRun(h, cmd); err != nil {
+			if restoreErr := restoreServerData(h, s); restoreErr != nil {
+				log.Error(restoreErr)
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// replacedServerData is where moveServerData moves what was in s.DataDir
+func replacedServerData(s config.ServerSettings) string {
+	return s.DataDir + "-replaced"
+}
+
+// checkReplacedServerData returns an error if there is data moved aside by an earlier
+// upgrade or restore that failed, rather than overwriting it
+func checkReplacedServerData(h *host.Host, s config.ServerSettings) error {
+	replaced := replacedServerData(s)
+	if _, err := h.RunSSHCommand("[ ! -e " + replaced + " ]"); err != nil {
+		return fmt.Errorf("%s is left from an earlier upgrade-server or restore that failed, move it out of the way first", replaced)
+	}
+	return nil
+}
+
+// restoreServerData puts back what moveServerData moved out of s.DataDir. If nothing was
+// moved aside, s.DataDir is left alone, as it may still be the original.
+func restoreServerData(h *host.Host, s config.ServerSettings) error {
+	replaced := replacedServerData(s)
+	return sshRun(h, "if [ -e "+replaced+" ]; then sudo rm -rf "+s.DataDir+" && sudo mv "+replaced+" "+s.DataDir+"; fi")
+}
+
+// verifyServerDataCopy checks that every file in the server container's database has
+// been copied to tmp unchanged
+func verifyServerDataCopy(h *host.Host, tmp string) error {
+	want, err := treeChecksums(h, "sudo docker cp "+serverContainer+":/var/lib/mysql -")
+	if err != nil {
+		return err
+	}
+	got, err := treeChecksums(h, "sudo tar cf - -C "+path.Dir(tmp)+" "+path.Base(tmp))
+	if err != nil {
+		return err
+	}
+	for name, sum := range want {
+		if got[name] != sum {
+			return fmt.Errorf("The copy of the Rancher Server data in %s doesn't match the container's (%s differs)", tmp, name)
+		}
+	}
+	if len(got) != len(want) {
+		return fmt.Errorf("The copy of the Rancher Server data in %s has %d files, the container has %d", tmp, len(got), len(want))
+	}
+	log.Debugf("Verified the %d files copied to %s", len(got), tmp)
+	return nil
+}
+
+// treeChecksums reads the tar archive that cmd writes in the vm, returning the sha256 of
+// each file in it, keyed by its path below the archive's top directory
+func treeChecksums(h *host.Host, cmd string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := sshStream(h, cmd, func(stdout io.Reader) error {
+		tr := tar.NewReader(stdout)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			sum := sha256.New()
+			if _, err := io.Copy(sum, tr); err != nil {
+				return err
+			}
+			name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+			name = name[strings.Index(name, "/")+1:]
+			sums[name] = hex.EncodeToString(sum.Sum(nil))
+		}
+	})
+	return sums, err
+}
+
+// backupServerData archives s.DataDir next to it in the vm, returning the archive's path
+func backupServerData(h *host.Host, s config.ServerSettings) (string, error) {
+	backup := path.Join(path.Dir(s.DataDir), "backups", time.Now().UTC().Format("20060102-150405")+".tar.gz")
+	if err := sshRun(h, "sudo mkdir -p "+path.Dir(backup)); err != nil {
+		return "", err
+	}
+	return backup, sshRun(h, "sudo tar czf "+backup+" -C "+s.DataDir+" .")
+}
+
+// restartServer starts the original server container again after a failed upgrade, putting
+// back s.DataDir if moveServerData moved the data
+func restartServer(h *host.Host, s config.ServerSettings, moved bool) error {
+	if moved {
+		if err := restoreServerData(h, s); err != nil {
+			return err
+		}
+	}
+	return sshRun(h, "docker start "+serverContainer)
+}
+
+// rollbackServer removes the new server container, restores the data (the new version may
+// have migrated the database) and starts the previous container again. If the data was
+// moved, the previous container doesn't use s.DataDir, which is put back as it was;
+// otherwise s.DataDir is restored from backup.
+func rollbackServer(h *host.Host, s config.ServerSettings, backup string, moved bool) error {
+	h.RunSSHCommand("docker rm -f " + serverContainer)
+	cmds := []string{
+		"sudo rm -rf " + s.DataDir,
+		"sudo mkdir -p " + s.DataDir,
+		"sudo tar xzf " + backup + " -C " + s.DataDir,
+	}
+	if moved {
+		if err := restoreServerData(h, s); err != nil {
+			return err
+		}
+		cmds = nil
+	}
+	cmds = append(cmds,
+		"docker rename "+previousServerContainer+" "+serverContainer,
+		"docker start "+serverContainer,
+	)
+	for _, cmd := range cmds {
+		if err := sshRun(h, cmd); err != nil {
+			return err
+		}
+	}
+	log.Infof("Rolled back, the previous Rancher Server is starting")
+	return nil
+}
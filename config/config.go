@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 )
 
@@ -9,33 +11,128 @@ var LogDir = "/usr/local/share/rancher/logs/"
 var RancherBinDir = "/usr/local/share/rancher/bin/"
 var GlobalBinDir = "/usr/local/bin/"
 
-// TODO: extract the "get latest version number URL into the struct too"
-// docker has a file at https://get.docker.com/latest
+// RancherOSIsoUrl is the RancherOS release that `start` boots
+var RancherOSIsoUrl = "https://releases.rancher.com/os/latest/rancheros.iso"
+
+// RancherOSIsoChecksumUrl is the checksum file published alongside RancherOSIsoUrl
+var RancherOSIsoChecksumUrl = "https://releases.rancher.com/os/latest/iso-checksums.txt"
+
+// RancherOSIso is where `install --from-bundle` puts the bundled RancherOS iso for `start` to use
+var RancherOSIso = "/usr/local/share/rancher/rancheros.iso"
+
+// InstallFile describes one tool that `desktop install` downloads and links into the PATH.
+// UrlPath, UrlFile, VersionUrl and ChecksumUrl are templates, see TemplateVars.
+// Version pins the tool to one version (like "v0.8.2"), or a semver range (like ">=0.8.0 <0.9.0")
+// which is resolved using the GitHub releases of UrlPath.
+// If there's no Version, VersionUrl is where to find the latest version - either a GitHub style
+// `/latest` redirect, or a plain text file like https://get.docker.com/latest.
+// If empty, UrlPath + "/latest" is used.
+// Sha256 is the expected checksum of the download, or ChecksumUrl points to a `sha256sum` style
+// file (like the SHA256SUMS published with GitHub releases) that contains it. Without either,
+// a download from GitHub releases is checked against the digest GitHub keeps for the asset.
 type InstallFile struct {
-	Command, UrlPath, UrlFile string
+	Command     string `json:"command" yaml:"command"`
+	UrlPath     string `json:"urlpath" yaml:"urlpath"`
+	UrlFile     string `json:"urlfile" yaml:"urlfile"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+	VersionUrl  string `json:"versionurl,omitempty" yaml:"versionurl,omitempty"`
+	Sha256      string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	ChecksumUrl string `json:"checksumurl,omitempty" yaml:"checksumurl,omitempty"`
 }
 
-// TODO: can get the latest version number of docker client from https://get.docker.com/latest
-// TODO: extract this to cfg files
+// InstallCfg is the built-in install manifest, used when no --manifest is specified.
+// It's keyed by ProfileName (GOOS/GOARCH).
 var InstallCfg = map[string][]InstallFile{
-	"darwin": []InstallFile{
-		InstallFile{"docker", "https://get.docker.com/builds/Darwin/x86_64/", "docker-1.12.3.tgz"},
-		InstallFile{"docker-machine", "https://github.com/docker/machine/releases", "docker-machine-Darwin-x86_64"},
-		InstallFile{"docker-machine-driver-xhyve", "https://github.com/zchee/docker-machine-driver-xhyve/releases", "docker-machine-driver-xhyve"},
-		InstallFile{"rancher", "https://github.com/rancher/cli/releases", "rancher-darwin-amd64-{{.Version}}.tar.gz"},
+	"darwin/amd64": []InstallFile{
+		InstallFile{Command: "docker", UrlPath: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/", UrlFile: "docker-{{.Version}}.tgz", Version: "1.12.3", ChecksumUrl: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/docker-{{.Version}}.tgz.sha256"},
+		InstallFile{Command: "docker-machine", UrlPath: "https://github.com/docker/machine/releases", UrlFile: "docker-machine-{{.UnameOS}}-{{.UnameArch}}", ChecksumUrl: "https://github.com/docker/machine/releases/download/{{.Version}}/sha256sum.txt"},
+		InstallFile{Command: "docker-machine-driver-xhyve", UrlPath: "https://github.com/zchee/docker-machine-driver-xhyve/releases", UrlFile: "docker-machine-driver-xhyve"},
+		InstallFile{Command: "rancher", UrlPath: "https://github.com/rancher/cli/releases", UrlFile: "rancher-{{.OS}}-{{.Arch}}-{{.Version}}.tar.gz"},
 	},
-	"windows": []InstallFile{
-		InstallFile{"docker.exe", "https://get.docker.com/builds/Windows/x86_64/", "docker-1.12.3.zip"},
-		InstallFile{"docker-machine", "https://github.com/docker/machine/releases", "docker-machine-Windows-x86_64.exe"},
-		InstallFile{"docker-machine-driver-vmware", "https://github.com/pecigonzalo/docker-machine-vmwareworkstation/releases", "docker-machine-driver-vmwareworkstation.exe"},
-		InstallFile{"rancher.exe", "https://github.com/rancher/cli/releases", "rancher-windows-amd64-{{.Version}}.zip"},
+	"windows/amd64": []InstallFile{
+		InstallFile{Command: "docker.exe", UrlPath: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/", UrlFile: "docker-{{.Version}}.zip", Version: "1.12.3", ChecksumUrl: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/docker-{{.Version}}.zip.sha256"},
+		InstallFile{Command: "docker-machine", UrlPath: "https://github.com/docker/machine/releases", UrlFile: "docker-machine-{{.UnameOS}}-{{.UnameArch}}.exe", ChecksumUrl: "https://github.com/docker/machine/releases/download/{{.Version}}/sha256sum.txt"},
+		InstallFile{Command: "docker-machine-driver-vmwareworkstation", UrlPath: "https://github.com/pecigonzalo/docker-machine-vmwareworkstation/releases", UrlFile: "docker-machine-driver-vmwareworkstation.exe"},
+		InstallFile{Command: "rancher.exe", UrlPath: "https://github.com/rancher/cli/releases", UrlFile: "rancher-{{.OS}}-{{.Arch}}-{{.Version}}.zip"},
 	},
-	"linux64": []InstallFile{
-		InstallFile{"docker", "https://get.docker.com/builds/Linux/x86_64/", "docker-1.12.3.tgz"},
-		InstallFile{},
-		InstallFile{},
-		InstallFile{},
+	"linux/amd64": []InstallFile{
+		InstallFile{Command: "docker", UrlPath: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/", UrlFile: "docker-{{.Version}}.tgz", Version: "1.12.3", ChecksumUrl: "https://get.docker.com/builds/{{.UnameOS}}/{{.UnameArch}}/docker-{{.Version}}.tgz.sha256"},
+		InstallFile{Command: "docker-machine", UrlPath: "https://github.com/docker/machine/releases", UrlFile: "docker-machine-{{.UnameOS}}-{{.UnameArch}}", ChecksumUrl: "https://github.com/docker/machine/releases/download/{{.Version}}/sha256sum.txt"},
+		// later releases are built per distribution (docker-machine-driver-kvm-ubuntu16.04)
+		InstallFile{Command: "docker-machine-driver-kvm", UrlPath: "https://github.com/dhiltgen/docker-machine-kvm/releases", UrlFile: "docker-machine-driver-kvm", Version: "v0.7.0"},
+		InstallFile{Command: "rancher", UrlPath: "https://github.com/rancher/cli/releases", UrlFile: "rancher-{{.OS}}-{{.Arch}}-{{.Version}}.tar.gz"},
 	},
+	// get.docker.com only has x86_64 docker builds, docker-machine and xhyve have no
+	// Darwin arm64 builds, and docker-machine-driver-kvm is only built for x86_64
+	"darwin/arm64": []InstallFile{
+		InstallFile{Command: "rancher", UrlPath: "https://github.com/rancher/cli/releases", UrlFile: "rancher-{{.OS}}-{{.Arch}}-{{.Version}}.tar.gz"},
+	},
+	"linux/arm64": []InstallFile{
+		InstallFile{Command: "docker-machine", UrlPath: "https://github.com/docker/machine/releases", UrlFile: "docker-machine-{{.UnameOS}}-{{.UnameArch}}", ChecksumUrl: "https://github.com/docker/machine/releases/download/{{.Version}}/sha256sum.txt"},
+		InstallFile{Command: "rancher", UrlPath: "https://github.com/rancher/cli/releases", UrlFile: "rancher-{{.OS}}-{{.Arch}}-{{.Version}}.tar.gz"},
+	},
+}
+
+// ReceiptFileName is the install receipt in RancherBinDir
+const ReceiptFileName = "receipt.json"
+
+// UserDirs is true when desktop is using the user's home directory, see UseUserDirs
+var UserDirs = false
+
+// UseUserDirs installs into the user's home directory instead of the system wide directories,
+// for `--user` installs, and when sudo can't be used
+func UseUserDirs() error {
+	logDir, binDir, globalBinDir, iso, err := userDirs()
+	if err != nil {
+		return err
+	}
+	LogDir, RancherBinDir, GlobalBinDir, RancherOSIso = logDir, binDir, globalBinDir, iso
+	UserDirs = true
+	return nil
+}
+
+// UserInstalled reports whether desktop has been installed into the user's home directory,
+// and not system wide
+func UserInstalled() bool {
+	_, userBinDir, _, _, err := userDirs()
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(userBinDir, ReceiptFileName)); err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(RancherBinDir, ReceiptFileName))
+	return os.IsNotExist(err)
+}
+
+// userDirs follows the XDG base directory spec: tools and the iso go in $XDG_DATA_HOME
+// (~/.local/share), logs in $XDG_STATE_HOME (~/.local/state), and the softlinks in ~/.local/bin.
+// On Windows, they go in %LOCALAPPDATA% and %USERPROFILE%\bin.
+func userDirs() (logDir, binDir, globalBinDir, iso string, err error) {
+	sep := string(filepath.Separator)
+	if runtime.GOOS == "windows" {
+		localAppData, profile := os.Getenv("LOCALAPPDATA"), os.Getenv("USERPROFILE")
+		if localAppData == "" || profile == "" {
+			return "", "", "", "", fmt.Errorf("Can't find your home directory, LOCALAPPDATA or USERPROFILE is not set")
+		}
+		local := filepath.Join(localAppData, "rancher")
+		return filepath.Join(local, "logs") + sep, filepath.Join(local, "bin") + sep,
+			filepath.Join(profile, "bin") + sep, filepath.Join(local, "rancheros.iso"), nil
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", "", "", "", fmt.Errorf("Can't find your home directory, HOME is not set")
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		data = filepath.Join(home, ".local", "share")
+	}
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "rancher", "logs") + sep, filepath.Join(data, "rancher", "bin") + sep,
+		filepath.Join(home, ".local", "bin") + sep, filepath.Join(data, "rancher", "rancheros.iso"), nil
 }
 
 func init() {
@@ -43,5 +140,7 @@ func init() {
 		LogDir = os.ExpandEnv("${ALLUSERSPROFILE}/rancher/logs/")
 		RancherBinDir = os.ExpandEnv("${ALLUSERSPROFILE}/rancher/bin/")
 		GlobalBinDir = os.ExpandEnv("${USERPROFILE}/bin/")
+		RancherOSIso = os.ExpandEnv("${ALLUSERSPROFILE}/rancher/rancheros.iso")
+		SettingsFile = os.ExpandEnv("${USERPROFILE}/.rancher/desktop.yml")
 	}
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// ManifestVersion is the install manifest format version this build understands
+const ManifestVersion = 1
+
+// Manifest is the on-disk (or on-the-web) form of InstallCfg, so tool versions can be
+// rolled without rebuilding desktop.
+//
+//	version: 1
+//	profiles:
+//	  darwin:
+//	  - command: docker
+//	    urlpath: https://get.docker.com/builds/Darwin/x86_64/
+//	    urlfile: docker-1.12.3.tgz
+type Manifest struct {
+	Version  int                      `json:"version" yaml:"version"`
+	Profiles map[string][]InstallFile `json:"profiles" yaml:"profiles"`
+}
+
+// LoadInstallCfg returns the install profiles from the manifest at location (a local file or
+// http(s) URL), or the built-in InstallCfg if location is empty.
+func LoadInstallCfg(location string) (map[string][]InstallFile, error) {
+	if location == "" {
+		return InstallCfg, nil
+	}
+	m, err := LoadManifest(location)
+	if err != nil {
+		return nil, err
+	}
+	return m.Profiles, nil
+}
+
+// LoadManifest reads a YAML or JSON install manifest from a local file or http(s) URL
+func LoadManifest(location string) (*Manifest, error) {
+	data, err := readLocation(location)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading manifest %s (%s)", location, err)
+	}
+
+	m := &Manifest{}
+	if strings.EqualFold(filepath.Ext(location), ".json") {
+		err = json.Unmarshal(data, m)
+	} else {
+		err = candiedyaml.Unmarshal(data, m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest %s (%s)", location, err)
+	}
+
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("Manifest %s is version %d, this desktop only understands version %d", location, m.Version, ManifestVersion)
+	}
+	for profile, files := range m.Profiles {
+		for i, f := range files {
+			if f.Command == "" || f.UrlPath == "" || f.UrlFile == "" {
+				return nil, fmt.Errorf("Manifest %s: %s entry %d needs a command, urlpath and urlfile", location, profile, i)
+			}
+		}
+	}
+	return m, nil
+}
+
+func readLocation(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return ioutil.ReadFile(location)
+	}
+	resp, err := http.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned %s", location, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
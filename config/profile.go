@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// unameOS and unameArch map Go's names to the `uname -s` and `uname -m` style names
+// used in many release file names (docker-machine-Darwin-x86_64)
+var unameOS = map[string]string{
+	"darwin":  "Darwin",
+	"linux":   "Linux",
+	"windows": "Windows",
+}
+
+var unameArch = map[string]string{
+	"amd64": "x86_64",
+	"386":   "i386",
+	"arm64": "aarch64",
+	"arm":   "armhf",
+}
+
+// ProfileName is the InstallCfg key for an OS and architecture, like "darwin/amd64"
+func ProfileName(goos, goarch string) string {
+	return goos + "/" + goarch
+}
+
+// CurrentProfile is the install profile for the computer desktop is running on
+func CurrentProfile() string {
+	return ProfileName(runtime.GOOS, runtime.GOARCH)
+}
+
+// Profile returns the InstallFiles for the named profile. Older manifests keyed only by OS
+// name are used for amd64, as that's the only architecture their urls could describe.
+func Profile(cfg map[string][]InstallFile, profile string) ([]InstallFile, error) {
+	if files, ok := cfg[profile]; ok {
+		return files, nil
+	}
+	goos, goarch := splitProfile(profile)
+	if files, ok := cfg[goos]; ok && goarch == "amd64" {
+		return files, nil
+	}
+	return nil, fmt.Errorf("No install profile for %s", profile)
+}
+
+// TemplateVars returns the values available to the InstallFile templates for the profile:
+// {{.Version}}, {{.OS}} and {{.Arch}} (Go's names, darwin, amd64), and
+// {{.UnameOS}} and {{.UnameArch}} (Darwin, x86_64)
+func TemplateVars(profile, version string) map[string]interface{} {
+	goos, goarch := splitProfile(profile)
+	vars := map[string]interface{}{
+		"Version":   version,
+		"OS":        goos,
+		"Arch":      goarch,
+		"UnameOS":   goos,
+		"UnameArch": goarch,
+	}
+	if name, ok := unameOS[goos]; ok {
+		vars["UnameOS"] = name
+	}
+	if name, ok := unameArch[goarch]; ok {
+		vars["UnameArch"] = name
+	}
+	return vars
+}
+
+func splitProfile(profile string) (goos, goarch string) {
+	parts := strings.SplitN(profile, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], "amd64"
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// SettingsFile is desktop's own config file
+var SettingsFile = os.ExpandEnv("${HOME}/.rancher/desktop.yml")
+
+// MachineSettings configure the RancherOS vm that `start` creates.
+// Memory and DiskSize are in MB. BootCmd (the kernel command line) and NFSShare are only
+// used by the xhyve driver.
+type MachineSettings struct {
+	Name          string `json:"name,omitempty" yaml:"name,omitempty"`
+	Driver        string `json:"driver,omitempty" yaml:"driver,omitempty"`
+	CPU           int    `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory        int    `json:"memory,omitempty" yaml:"memory,omitempty"`
+	DiskSize      int    `json:"disksize,omitempty" yaml:"disksize,omitempty"`
+	StorageDriver string `json:"storagedriver,omitempty" yaml:"storagedriver,omitempty"`
+	Iso           string `json:"iso,omitempty" yaml:"iso,omitempty"`
+	BootCmd       string `json:"bootcmd,omitempty" yaml:"bootcmd,omitempty"`
+	NFSShare      *bool  `json:"nfsshare,omitempty" yaml:"nfsshare,omitempty"`
+}
+
+// ServerSettings configure the Rancher Server container in the vm, and how desktop uses it.
+// DataDir is on the vm's persistent disk. The API key is only needed once access control
+// is enabled in Rancher. CliURL is set by `start` to the URL it configured the rancher cli
+// with, so `uninstall` can tell the cli config is desktop's even when the vm is stopped.
+type ServerSettings struct {
+	Image     string `json:"image,omitempty" yaml:"image,omitempty"`
+	Version   string `json:"version,omitempty" yaml:"version,omitempty"`
+	DataDir   string `json:"datadir,omitempty" yaml:"datadir,omitempty"`
+	AccessKey string `json:"accesskey,omitempty" yaml:"accesskey,omitempty"`
+	SecretKey string `json:"secretkey,omitempty" yaml:"secretkey,omitempty"`
+	CliURL    string `json:"cliurl,omitempty" yaml:"cliurl,omitempty"`
+}
+
+// InstallSettings configure `install`. If AutoPrune is set, install removes all but the
+// newest Keep versions of each tool after installing. Channel is the release channel that
+// desktop updates itself from: stable, beta, nightly or the URL of a release feed.
+type InstallSettings struct {
+	AutoPrune bool   `json:"autoprune,omitempty" yaml:"autoprune,omitempty"`
+	Keep      int    `json:"keep,omitempty" yaml:"keep,omitempty"`
+	Channel   string `json:"channel,omitempty" yaml:"channel,omitempty"`
+}
+
+// Settings is the content of the SettingsFile
+//
+//	machine:
+//	  name: rancher
+//	  memory: 2048
+//	server:
+//	  accesskey: ...
+type Settings struct {
+	Machine MachineSettings `json:"machine" yaml:"machine"`
+	Server  ServerSettings  `json:"server" yaml:"server"`
+	Install InstallSettings `json:"install" yaml:"install"`
+}
+
+// Current is the defaults, overridden by anything set in the SettingsFile
+var Current = DefaultSettings()
+
+// DefaultSettings are used for anything not set in the SettingsFile
+func DefaultSettings() Settings {
+	// use the driver that `install` installs
+	driver := "virtualbox"
+	switch runtime.GOOS {
+	case "darwin":
+		driver = "xhyve"
+	case "linux":
+		driver = "kvm"
+	case "windows":
+		driver = "vmwareworkstation"
+	}
+	return Settings{
+		Machine: MachineSettings{
+			Name:          "rancher",
+			Driver:        driver,
+			CPU:           2,
+			Memory:        4096,
+			DiskSize:      20000,
+			StorageDriver: "overlay",
+			Iso:           RancherOSIsoUrl,
+		},
+		Server: ServerSettings{
+			Image:   "rancher/server",
+			Version: "stable",
+			DataDir: "/var/lib/rancher/server/mysql",
+		},
+		Install: InstallSettings{
+			Keep:    2,
+			Channel: "stable",
+		},
+	}
+}
+
+// LoadSettings reads the settings file into Current. A missing file is not an error.
+func LoadSettings(filename string) error {
+	Current = DefaultSettings()
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	loaded := Settings{}
+	if err := candiedyaml.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("Error parsing %s (%s)", filename, err)
+	}
+	Current.Machine.merge(loaded.Machine)
+	Current.Server.merge(loaded.Server)
+	Current.Install.merge(loaded.Install)
+	return nil
+}
+
+// UpdateSettings changes the settings file, keeping what is already set in it.
+// Only what is in the file is changed, not the defaults.
+func UpdateSettings(filename string, update func(*Settings)) error {
+	saved := Settings{}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := candiedyaml.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("Error parsing %s (%s)", filename, err)
+		}
+	}
+	update(&saved)
+	data, err = candiedyaml.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// merge overrides the settings with those set in other
+func (m *MachineSettings) merge(other MachineSettings) {
+	if other.Name != "" {
+		m.Name = other.Name
+	}
+	if other.Driver != "" {
+		m.Driver = other.Driver
+	}
+	if other.CPU != 0 {
+		m.CPU = other.CPU
+	}
+	if other.Memory != 0 {
+		m.Memory = other.Memory
+	}
+	if other.DiskSize != 0 {
+		m.DiskSize = other.DiskSize
+	}
+	if other.StorageDriver != "" {
+		m.StorageDriver = other.StorageDriver
+	}
+	if other.Iso != "" {
+		m.Iso = other.Iso
+	}
+	if other.BootCmd != "" {
+		m.BootCmd = other.BootCmd
+	}
+	if other.NFSShare != nil {
+		m.NFSShare = other.NFSShare
+	}
+}
+
+// merge overrides the settings with those set in other
+func (s *ServerSettings) merge(other ServerSettings) {
+	if other.Image != "" {
+		s.Image = other.Image
+	}
+	if other.Version != "" {
+		s.Version = other.Version
+	}
+	if other.DataDir != "" {
+		s.DataDir = other.DataDir
+	}
+	if other.AccessKey != "" {
+		s.AccessKey = other.AccessKey
+	}
+	if other.SecretKey != "" {
+		s.SecretKey = other.SecretKey
+	}
+}
+
+// merge overrides the settings with those set in other
+func (i *InstallSettings) merge(other InstallSettings) {
+	if other.AutoPrune {
+		i.AutoPrune = true
+	}
+	if other.Keep != 0 {
+		i.Keep = other.Keep
+	}
+	if other.Channel != "" {
+		i.Channel = other.Channel
+	}
+}
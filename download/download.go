@@ -0,0 +1,177 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Retries is how many times a failed download is retried before giving up
+var Retries = 5
+
+// Backoff is the delay before the first retry, it doubles for every following retry
+var Backoff = 2 * time.Second
+
+// StatusError is returned when the server responds with a non-2xx status
+type StatusError struct {
+	Url        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Url, e.Status)
+}
+
+// Temporary reports whether retrying the request might succeed
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Get downloads url into the file to, retrying with backoff, and resuming from where the last
+// attempt stopped. The data is written to `to + ".part"`, and only renamed to `to` once
+// complete, so `to` is never a truncated file. The ETag or Last-Modified of the partial
+// download is kept in `to + ".part.validator"`, so it's only resumed if the file is unchanged.
+func Get(url, to string) error {
+	partial := to + ".part"
+	return retry(url, func() error {
+		return getPartial(url, partial)
+	}, func() error {
+		os.Remove(partial + validatorSuffix)
+		return os.Rename(partial, to)
+	})
+}
+
+const validatorSuffix = ".validator"
+
+// ReadAll returns the body of url (for small files like checksums and version info),
+// retrying with backoff
+func ReadAll(url string) ([]byte, error) {
+	var data []byte
+	err := retry(url, func() error {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := checkStatus(url, resp); err != nil {
+			return err
+		}
+		data, err = ioutil.ReadAll(resp.Body)
+		return err
+	}, nil)
+	return data, err
+}
+
+func retry(url string, attempt, done func() error) error {
+	wait := Backoff
+	var err error
+	for try := 0; try <= Retries; try++ {
+		if try > 0 {
+			log.Infof("Retrying download of %s in %s (%s)", url, wait, err)
+			time.Sleep(wait)
+			wait *= 2
+		}
+		err = attempt()
+		if err == nil {
+			if done != nil {
+				return done()
+			}
+			return nil
+		}
+		if statusErr, ok := err.(*StatusError); ok && !statusErr.Temporary() {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up on %s after %d attempts: %s", url, Retries+1, err)
+}
+
+// getPartial appends to whatever is already in partial, using a Range request with If-Range,
+// so the server sends the whole file instead if it has changed. A partial download without
+// a validator can't be checked, so it is started again.
+func getPartial(url, partial string) error {
+	var offset int64
+	validator, _ := ioutil.ReadFile(partial + validatorSuffix)
+	if fi, err := os.Stat(partial); err == nil && len(validator) > 0 {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", string(validator))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		log.Debugf("Resuming download of %s at %d bytes", url, offset)
+		flags |= os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// most likely the partial file is already complete, or is from a different file
+		// TODO: check the Content-Range total size instead of starting again
+		os.Remove(partial)
+		return fmt.Errorf("unable to resume %s (%s)", url, resp.Status)
+	default:
+		if err := checkStatus(url, resp); err != nil {
+			return err
+		}
+		// the server ignored the Range header, or the file changed, so start from scratch
+		flags |= os.O_TRUNC
+		if err := saveValidator(partial, resp); err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Downloading %s into %s", url, partial)
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("short read from %s: got %d of %d bytes", url, n, resp.ContentLength)
+	}
+	return out.Close()
+}
+
+// saveValidator keeps the response's strong ETag, or its Last-Modified date, for resuming
+// the download of partial with If-Range
+func saveValidator(partial string, resp *http.Response) error {
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		// weak ETags can't be used with If-Range
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		os.Remove(partial + validatorSuffix)
+		return nil
+	}
+	return ioutil.WriteFile(partial+validatorSuffix, []byte(validator), 0644)
+}
+
+func checkStatus(url string, resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package download
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	Backoff = time.Millisecond
+}
+
+var content = bytes.Repeat([]byte("0123456789abcdef"), 1024)
+
+// requestLog records the Range and If-Range headers of each request a test server gets
+type requestLog struct {
+	sync.Mutex
+	ranges []string
+}
+
+func (l *requestLog) add(r *http.Request) int {
+	l.Lock()
+	defer l.Unlock()
+	l.ranges = append(l.ranges, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+	return len(l.ranges)
+}
+
+func serveContent(w http.ResponseWriter, r *http.Request, etag string) {
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+}
+
+func TestGetResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		partial   []byte
+		validator string
+		ranges    []string
+	}{
+		{"fresh download", nil, "", []string{"|"}},
+		{"resume", content[:1000], `"v1"`, []string{`bytes=1000-|"v1"`}},
+		{"file changed", []byte("stale data"), `"v0"`, []string{`bytes=10-|"v0"`}},
+		{"no validator", []byte("unversioned"), "", []string{"|"}},
+		{"already complete", content, `"v1"`, []string{`bytes=16384-|"v1"`, "|"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := &requestLog{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				log.add(r)
+				serveContent(w, r, `"v1"`)
+			}))
+			defer ts.Close()
+
+			dir, err := ioutil.TempDir("", "download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			to := filepath.Join(dir, "file")
+			if test.partial != nil {
+				if err := ioutil.WriteFile(to+".part", test.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.validator != "" {
+				if err := ioutil.WriteFile(to+".part"+validatorSuffix, []byte(test.validator), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Get(ts.URL, to); err != nil {
+				t.Fatal(err)
+			}
+			checkDownload(t, to)
+			if len(log.ranges) != len(test.ranges) {
+				t.Fatalf("expected requests %q, got %q", test.ranges, log.ranges)
+			}
+			for i := range test.ranges {
+				if log.ranges[i] != test.ranges[i] {
+					t.Errorf("request %d: expected Range|If-Range %q, got %q", i, test.ranges[i], log.ranges[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(w http.ResponseWriter, r *http.Request, n int)
+		requests int
+		fails    bool
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request, n int) {
+			if n < 3 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			serveContent(w, r, `"v1"`)
+		}, 3, false},
+		{"dropped connection", func(w http.ResponseWriter, r *http.Request, n int) {
+			if n == 1 {
+				// promise the whole file, but only send half of it
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Content-Length", "16384")
+				w.Write(content[:8192])
+				return
+			}
+			if r.Header.Get("Range") != "bytes=8192-" {
+				t.Errorf("expected the retry to resume, got Range %q", r.Header.Get("Range"))
+			}
+			serveContent(w, r, `"v1"`)
+		}, 2, false},
+		{"not found", func(w http.ResponseWriter, r *http.Request, n int) {
+			http.NotFound(w, r)
+		}, 1, true},
+		{"always failing", func(w http.ResponseWriter, r *http.Request, n int) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}, Retries + 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := &requestLog{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				test.handler(w, r, log.add(r))
+			}))
+			defer ts.Close()
+
+			dir, err := ioutil.TempDir("", "download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			to := filepath.Join(dir, "file")
+
+			err = Get(ts.URL, to)
+			if test.fails {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				if _, err := os.Stat(to); !os.IsNotExist(err) {
+					t.Errorf("expected no %s after a failed download", to)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkDownload(t, to)
+			}
+			if len(log.ranges) != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, len(log.ranges))
+			}
+		})
+	}
+}
+
+func checkDownload(t *testing.T, to string) {
+	data, err := ioutil.ReadFile(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes that don't match the %d served", len(data), len(content))
+	}
+	for _, leftover := range []string{to + ".part", to + ".part" + validatorSuffix} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", leftover)
+		}
+	}
+}
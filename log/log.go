@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -28,17 +29,26 @@ func StopLogging() {
 	logrus.Debugf("Stopped logging to file")
 }
 
+// logDirPending is true when the log dir needs sudo to create, see LogDirPending
+var logDirPending = false
+
 func InitLogging(logLevel logrus.Level, version string) {
 	// TODO: i'm trusting that no-one has messed with it since we last made it..
 	if _, err := os.Stat(config.LogDir); err != nil {
-		if err := util.SudoRun("mkdir", "-p", config.LogDir); err != nil {
-			logrus.Fatal(err)
-		}
-		if err := util.SudoRun("chmod", "777", config.LogDir); err != nil {
+		if util.Sudo {
+			// install creates it with its other privileged steps, rather than asking for sudo
+			// just for this; until then, the log only goes to the terminal
+			logDirPending = true
+		} else if err := os.MkdirAll(config.LogDir, 0755); err != nil {
 			logrus.Fatal(err)
+		} else if !config.UserDirs {
+			// shared by everyone who runs desktop
+			if err := os.Chmod(config.LogDir, 0777); err != nil {
+				logrus.Fatal(err)
+			}
 		}
 	}
-	
+
 	if logrus.StandardLogger().Out != os.Stderr {
 		fmt.Printf("IDK\n")
 		logrus.Debugf("IDK")
@@ -46,17 +56,11 @@ func InitLogging(logLevel logrus.Level, version string) {
 
 	// Write all levels to a log file
 	logrus.SetLevel(logrus.DebugLevel)
-	if logFile == nil {
-		filename := filepath.Join(config.LogDir, "verbose-"+time.Now().Format("2006-01-02T15.04-")+strconv.Itoa(os.Getpid())+".log")
-		fmt.Printf("Debug log written to %s\n", filename)
-		f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to open %s log file, %v", filename, err)
-			logrus.Fatal(err)
-		}
-		logFile = f
+	if logDirPending {
+		logrus.SetOutput(ioutil.Discard)
+	} else if err := openLogFile(); err != nil {
+		logrus.Fatal(err)
 	}
-	logrus.SetOutput(logFile)
 
 	// Filter what the user sees (info level, unless they set --debug)
 	showuserHook, err := showuserlog.NewShowuserlogHook(logLevel)
@@ -84,3 +88,38 @@ func InitLogging(logLevel logrus.Level, version string) {
 	}
 	logrus.Debugf("START: %v in %s", os.Args, pwd)
 }
+
+// LogDirPending reports whether the log dir still has to be created (with sudo), so nothing
+// is being written to the log file yet
+func LogDirPending() bool {
+	return logDirPending
+}
+
+// StartFileLogging starts writing the log file, once install has created the log dir
+func StartFileLogging() error {
+	if !logDirPending {
+		return nil
+	}
+	logDirPending = false
+	if err := openLogFile(); err != nil {
+		return err
+	}
+	logrus.Debugf("START: %v", os.Args)
+	return nil
+}
+
+func openLogFile() error {
+	if logFile == nil {
+		filename := filepath.Join(config.LogDir, "verbose-"+time.Now().Format("2006-01-02T15.04-")+strconv.Itoa(os.Getpid())+".log")
+		// stderr, so stdout can be parsed (`desktop status --json`)
+		fmt.Fprintf(os.Stderr, "Debug log written to %s\n", filename)
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to open %s log file, %v", filename, err)
+			return err
+		}
+		logFile = f
+	}
+	logrus.SetOutput(logFile)
+	return nil
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/SvenDowideit/desktop/commands"
+	"github.com/SvenDowideit/desktop/config"
 	"github.com/SvenDowideit/desktop/log"
+	"github.com/SvenDowideit/desktop/util"
 
 	"github.com/urfave/cli"
 )
@@ -46,20 +48,73 @@ func main() {
 			Name:  "debug",
 			Usage: "enable debug output in the logs",
 		},
+		cli.StringFlag{
+			Name:   "settings",
+			Usage:  "desktop settings file",
+			Value:  config.SettingsFile,
+			EnvVar: "DESKTOP_SETTINGS",
+		},
+		cli.BoolFlag{
+			Name:   "user",
+			Usage:  "install into, and use, your home directory instead of the system wide directories (no sudo needed)",
+			EnvVar: "DESKTOP_USER",
+		},
+		cli.StringFlag{
+			Name:   "machine",
+			Usage:  "name of the RancherOS vm to use (overrides the settings file)",
+			EnvVar: "DESKTOP_MACHINE",
+		},
 	}
 	app.Commands = []cli.Command{
 		versionCommand,
 		commands.Install,
 		commands.Start,
 		commands.Stop,
+		commands.Status,
+		commands.UpgradeServer,
+		commands.Backup,
+		commands.Restore,
+		commands.List,
+		commands.Rollback,
+		commands.Prune,
 		commands.Uninstall,
+		commands.Bundle,
 	}
 	app.Before = func(context *cli.Context) error {
+		// keep using the user's home directory once desktop is installed there
+		userDirs := context.GlobalBool("user") || config.UserInstalled()
+		if userDirs {
+			if err := config.UseUserDirs(); err != nil {
+				return err
+			}
+		}
+		// CI agents and the like can't answer a sudo prompt, so install falls back to the
+		// user's home directory. The other commands fail if they need to change anything.
+		noSudo := false
+		sudo, err := util.CheckPrivileges(config.LogDir, config.RancherBinDir, config.GlobalBinDir)
+		if err != nil && !userDirs && context.Args().First() == commands.Install.Name {
+			if err := config.UseUserDirs(); err != nil {
+				return err
+			}
+			sudo, err = util.CheckPrivileges(config.LogDir, config.RancherBinDir, config.GlobalBinDir)
+			noSudo = true
+		}
+		util.Sudo, util.SudoErr = sudo, err
 		if context.GlobalBool("debug") {
 			log.InitLogging(logrus.DebugLevel, app.Version)
 		} else {
 			log.InitLogging(logrus.InfoLevel, app.Version)
 		}
+		if noSudo {
+			logrus.Warnf("sudo is not available, using %s and %s instead of the system wide directories", config.RancherBinDir, config.GlobalBinDir)
+		}
+
+		if err := config.LoadSettings(context.GlobalString("settings")); err != nil {
+			return err
+		}
+		if machine := context.GlobalString("machine"); machine != "" {
+			config.Current.Machine.Name = machine
+		}
 
 		return nil
 	}
@@ -0,0 +1,39 @@
+package rancher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Healthy checks that the Rancher Server at url (like http://192.168.64.18) answers its
+// /ping and /v1 API endpoints, returning an error that says which one isn't ready.
+// A 401 from /v1 means access control is enabled, so the server is still healthy.
+func Healthy(url string) error {
+	url = strings.TrimSuffix(url, "/")
+	httpClient := &http.Client{Timeout: Timeout}
+
+	resp, err := httpClient.Get(url + "/ping")
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "pong" {
+		return fmt.Errorf("%s/ping returned %s", url, resp.Status)
+	}
+
+	resp, err = httpClient.Get(url + "/v1")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("%s/v1 returned %s", url, resp.Status)
+	}
+	return nil
+}
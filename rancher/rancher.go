@@ -0,0 +1,138 @@
+package rancher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	client "github.com/rancher/go-rancher/v2"
+)
+
+// ApiVersion is the Rancher Server API path go-rancher/v2 talks to
+const ApiVersion = "/v2-beta"
+
+// DefaultProjectName is the environment a new Rancher Server creates
+const DefaultProjectName = "Default"
+
+// Timeout for each API request
+var Timeout = 30 * time.Second
+
+// Client talks to the Rancher Server in the desktop vm
+type Client struct {
+	// Url is the server's base url, like http://192.168.64.18
+	Url       string
+	AccessKey string
+	SecretKey string
+
+	account *client.RancherClient
+}
+
+// NewClient connects to the Rancher Server at url (like http://192.168.64.18),
+// using the API key if the server has access control enabled
+func NewClient(url, accessKey, secretKey string) (*Client, error) {
+	c := &Client{
+		Url:       strings.TrimSuffix(url, "/"),
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}
+	account, err := c.newRancherClient(c.Url + ApiVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.account = account
+	return c, nil
+}
+
+func (c *Client) newRancherClient(url string) (*client.RancherClient, error) {
+	log.Debugf("connecting to Rancher API %s", url)
+	rc, err := client.NewRancherClient(&client.ClientOpts{
+		Url:       url,
+		AccessKey: c.AccessKey,
+		SecretKey: c.SecretKey,
+		Timeout:   Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to Rancher API %s (%s)", url, err)
+	}
+	return rc, nil
+}
+
+// DefaultProject returns the environment called Default, or if there isn't one,
+// the first active environment
+func (c *Client) DefaultProject() (*client.Project, error) {
+	projects, err := c.account.Project.List(&client.ListOpts{
+		Filters: map[string]interface{}{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var found *client.Project
+	for i, p := range projects.Data {
+		if p.State != "active" {
+			continue
+		}
+		if p.Name == DefaultProjectName {
+			return &projects.Data[i], nil
+		}
+		if found == nil {
+			found = &projects.Data[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No active environment found in %s", c.Url)
+	}
+	return found, nil
+}
+
+// Project returns a client for the API of the environment with projectId
+func (c *Client) Project(projectId string) (*client.RancherClient, error) {
+	return c.newRancherClient(c.Url + ApiVersion + "/projects/" + projectId)
+}
+
+// RegistrationCommand returns the agent registration command for the environment, asking the
+// server to create a registration token if there isn't one. It returns "" (with no error)
+// while the new token is not ready yet, so call it again until it isn't empty.
+func (c *Client) RegistrationCommand(projectId string) (string, error) {
+	project, err := c.Project(projectId)
+	if err != nil {
+		return "", err
+	}
+	tokens, err := project.RegistrationToken.List(&client.ListOpts{
+		Filters: map[string]interface{}{},
+	})
+	if err != nil {
+		return "", err
+	}
+	pending := false
+	for _, t := range tokens.Data {
+		if t.State == "active" && t.Command != "" {
+			return t.Command, nil
+		}
+		if t.State == "active" || t.State == "activating" || t.State == "registering" {
+			pending = true
+		}
+	}
+	if !pending {
+		log.Debugf("requesting a new registration token for %s", projectId)
+		if _, err := project.RegistrationToken.Create(&client.RegistrationToken{}); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Hosts returns the hosts registered in the environment
+func (c *Client) Hosts(projectId string) ([]client.Host, error) {
+	project, err := c.Project(projectId)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := project.Host.List(&client.ListOpts{
+		Filters: map[string]interface{}{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts.Data, nil
+}
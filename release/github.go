@@ -0,0 +1,69 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SvenDowideit/desktop/download"
+)
+
+// Release is the subset of a GitHub release (https://developer.github.com/v3/repos/releases/)
+// that desktop uses
+type Release struct {
+	TagName    string  `json:"tag_name"`
+	Name       string  `json:"name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a Release. GitHub records a Digest ("sha256:<hex>") for
+// each asset it is given.
+type Asset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadUrl string `json:"browser_download_url"`
+	Digest             string `json:"digest,omitempty"`
+}
+
+// Sha256 returns the hex encoded SHA-256 from the asset's Digest, or "" if it has none
+func (a Asset) Sha256() string {
+	if !strings.HasPrefix(a.Digest, "sha256:") {
+		return ""
+	}
+	return strings.TrimPrefix(a.Digest, "sha256:")
+}
+
+// GithubApiUrl converts a https://github.com/<owner>/<repo>/releases url into its releases API url
+func GithubApiUrl(releasesUrl string) (string, error) {
+	path := strings.TrimPrefix(releasesUrl, "https://github.com/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if path == releasesUrl || len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("%s is not a GitHub releases url", releasesUrl)
+	}
+	return "https://api.github.com/repos/" + parts[0] + "/" + parts[1] + "/releases?per_page=100", nil
+}
+
+// ListGithub returns the releases listed for a https://github.com/<owner>/<repo>/releases url,
+// newest first
+func ListGithub(releasesUrl string) ([]Release, error) {
+	apiUrl, err := GithubApiUrl(releasesUrl)
+	if err != nil {
+		return nil, err
+	}
+	return List(apiUrl)
+}
+
+// List returns the releases from a GitHub releases API style JSON feed
+func List(feedUrl string) ([]Release, error) {
+	data, err := download.ReadAll(feedUrl)
+	if err != nil {
+		return nil, err
+	}
+	releases := []Release{}
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("Error parsing releases from %s (%s)", feedUrl, err)
+	}
+	return releases, nil
+}
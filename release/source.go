@@ -0,0 +1,76 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is somewhere that lists releases, like a GitHub repository's releases
+type Source interface {
+	Releases() ([]Release, error)
+	String() string
+}
+
+// GithubSource lists the releases of a https://github.com/<owner>/<repo>/releases url
+// using the GitHub releases API
+type GithubSource string
+
+func (s GithubSource) Releases() ([]Release, error) {
+	return ListGithub(string(s))
+}
+
+func (s GithubSource) String() string {
+	return string(s)
+}
+
+// FeedSource lists the releases in a JSON file in the same format as the GitHub releases API
+type FeedSource string
+
+func (s FeedSource) Releases() ([]Release, error) {
+	return List(string(s))
+}
+
+func (s FeedSource) String() string {
+	return string(s)
+}
+
+// LatestMatching returns the newest release from src that isn't a draft and that match
+// returns true for. Releases with tags that are neither semver nor dates are skipped.
+func LatestMatching(src Source, match func(Release) bool) (*Release, error) {
+	releases, err := src.Releases()
+	if err != nil {
+		return nil, err
+	}
+	var latest *Release
+	for i, r := range releases {
+		if r.Draft || !match(r) {
+			continue
+		}
+		if _, err := ParseVersion(r.TagName); err != nil {
+			continue
+		}
+		if latest == nil {
+			latest = &releases[i]
+			continue
+		}
+		if newer, err := Newer(r.TagName, latest.TagName); err == nil && newer {
+			latest = &releases[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("No releases found in %s", src)
+	}
+	return latest, nil
+}
+
+// Asset returns the release's asset called one of names, in order of preference
+func (r *Release) Asset(names ...string) (*Asset, error) {
+	for _, name := range names {
+		for i, a := range r.Assets {
+			if a.Name == name {
+				return &r.Assets[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Release %s has none of %s", r.TagName, strings.Join(names, ", "))
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// IsRange reports whether version is a semver range (like ">=0.8.0 <0.9.0"),
+// rather than one specific version
+func IsRange(version string) bool {
+	return strings.ContainsAny(version, "<>=!")
+}
+
+// NewestInRange returns the tag of the newest release (ignoring drafts and prereleases)
+// that satisfies the semver range
+func NewestInRange(releases []Release, versionRange string) (string, error) {
+	inRange, err := semver.ParseRange(versionRange)
+	if err != nil {
+		return "", fmt.Errorf("invalid version range %q (%s)", versionRange, err)
+	}
+
+	tag := ""
+	var newest semver.Version
+	for _, r := range releases {
+		if r.Draft || r.Prerelease {
+			continue
+		}
+		v, err := semver.ParseTolerant(r.TagName)
+		if err != nil || !inRange(v) {
+			continue
+		}
+		if tag == "" || v.GT(newest) {
+			tag, newest = r.TagName, v
+		}
+	}
+	if tag == "" {
+		return "", fmt.Errorf("no release matches %q", versionRange)
+	}
+	return tag, nil
+}
+
+// dateLayout is the format of desktop's date tagged releases (like 2016-11-10)
+const dateLayout = "2006-01-02"
+
+// Version is a release tag parsed as either a semver version or a date
+type Version struct {
+	Tag    string
+	Semver *semver.Version
+	Date   *time.Time
+}
+
+// ParseVersion parses a tag like v1.2.3 or 2016-11-10. Anything after a comma or space is
+// ignored, so the "2016-11-10, build 1234abc" version of a desktop build can be parsed.
+func ParseVersion(tag string) (*Version, error) {
+	tag = strings.TrimSpace(strings.SplitN(tag, ",", 2)[0])
+	tag = strings.SplitN(tag, " ", 2)[0]
+	if d, err := time.Parse(dateLayout, tag); err == nil {
+		return &Version{Tag: tag, Date: &d}, nil
+	}
+	if v, err := semver.ParseTolerant(tag); err == nil {
+		return &Version{Tag: tag, Semver: &v}, nil
+	}
+	return nil, fmt.Errorf("%q is neither a semver version nor a date", tag)
+}
+
+// Newer reports whether the tag is a newer version than current. It is an error to compare
+// versions that can't be parsed (like "dev"), or a date with a semver version.
+func Newer(tag, current string) (bool, error) {
+	v, err := ParseVersion(tag)
+	if err != nil {
+		return false, err
+	}
+	c, err := ParseVersion(current)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case v.Semver != nil && c.Semver != nil:
+		return v.Semver.GT(*c.Semver), nil
+	case v.Date != nil && c.Date != nil:
+		return v.Date.After(*c.Date), nil
+	}
+	return false, fmt.Errorf("Can't compare %s with %s", v.Tag, c.Tag)
+}
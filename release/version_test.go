@@ -0,0 +1,112 @@
+package release
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   string
+		semver bool
+		date   bool
+	}{
+		{"v1.2.3", "v1.2.3", true, false},
+		{"0.8.0", "0.8.0", true, false},
+		{"v0.9.0-rc1", "v0.9.0-rc1", true, false},
+		{"2016-11-10", "2016-11-10", false, true},
+		{"2016-11-10, build 1234abc", "2016-11-10", false, true},
+		{" 2016-11-10 build 1234abc", "2016-11-10", false, true},
+		{"dev", "", false, false},
+		{"", "", false, false},
+		{"2016-13-40", "", false, false},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.tag)
+		if !test.semver && !test.date {
+			if err == nil {
+				t.Errorf("ParseVersion(%q): expected an error, got %+v", test.tag, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %s", test.tag, err)
+			continue
+		}
+		if v.Tag != test.want || (v.Semver != nil) != test.semver || (v.Date != nil) != test.date {
+			t.Errorf("ParseVersion(%q) = %+v, expected tag %q, semver %t, date %t", test.tag, v, test.want, test.semver, test.date)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		tag, current string
+		newer        bool
+		fails        bool
+	}{
+		{"v1.2.4", "v1.2.3", true, false},
+		{"v1.2.3", "v1.2.3", false, false},
+		{"v1.2.3", "v1.10.0", false, false},
+		{"v1.0.0", "v1.0.0-rc1", true, false},
+		{"2016-11-11", "2016-11-10, build 1234abc", true, false},
+		{"2016-11-10", "2016-11-10", false, false},
+		{"2016-01-01", "2016-11-10", false, false},
+		{"2016-11-10", "v1.2.3", false, true},
+		{"v1.2.3", "2016-11-10", false, true},
+		{"v1.2.3", "dev", false, true},
+		{"dev", "v1.2.3", false, true},
+	}
+	for _, test := range tests {
+		newer, err := Newer(test.tag, test.current)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Newer(%q, %q): expected an error", test.tag, test.current)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Newer(%q, %q): %s", test.tag, test.current, err)
+		} else if newer != test.newer {
+			t.Errorf("Newer(%q, %q) = %t, expected %t", test.tag, test.current, newer, test.newer)
+		}
+	}
+}
+
+func TestNewestInRange(t *testing.T) {
+	releases := []Release{
+		{TagName: "v0.8.0"},
+		{TagName: "v0.8.2"},
+		{TagName: "v0.8.1"},
+		{TagName: "v0.8.3", Draft: true},
+		{TagName: "v0.9.0-rc1", Prerelease: true},
+		{TagName: "v0.9.0"},
+		{TagName: "nightly"},
+		{TagName: "v1.0.0"},
+	}
+	tests := []struct {
+		versionRange string
+		want         string
+		fails        bool
+	}{
+		{">=0.8.0 <0.9.0", "v0.8.2", false},
+		{">=0.8.0", "v1.0.0", false},
+		{"<0.9.0", "v0.8.2", false},
+		{">=0.9.0 <1.0.0", "v0.9.0", false},
+		{"<0.8.0", "", true},
+		{">=2.0.0", "", true},
+		{">=nonsense", "", true},
+	}
+	for _, test := range tests {
+		tag, err := NewestInRange(releases, test.versionRange)
+		if test.fails {
+			if err == nil {
+				t.Errorf("NewestInRange(%q): expected an error, got %s", test.versionRange, tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewestInRange(%q): %s", test.versionRange, err)
+		} else if tag != test.want {
+			t.Errorf("NewestInRange(%q) = %s, expected %s", test.versionRange, tag, test.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CacheDir returns the per-user directory desktop downloads into, creating it so only
+// the user can read it. A directory that someone else owns, or that is a symlink, is refused.
+func CacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "desktop")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("Download cache %s is not a directory", dir)
+	}
+	if !ownedByUser(fi) {
+		return "", fmt.Errorf("Download cache %s is owned by another user", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
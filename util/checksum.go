@@ -0,0 +1,107 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Sha256File returns the hex encoded SHA-256 of the file at filename
+func Sha256File(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySha256 returns an error unless the file at filename has the expected SHA-256
+func VerifySha256(filename, expected string) error {
+	actual, err := Sha256File(filename)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", filename, expected, actual)
+	}
+	return nil
+}
+
+// CopyVerified copies the file at filename into a new private file in dir, hashing what it
+// copies, so what gets installed is exactly what was checked. The copy is removed unless it
+// has the expected SHA-256; an empty expected skips the check.
+func CopyVerified(filename, dir, expected string) (string, error) {
+	from, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer from.Close()
+	to, err := ioutil.TempFile(dir, filepath.Base(filename)+"-verified-")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(to, h), from)
+	if cerr := to.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(to.Name())
+		return "", err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); expected != "" && !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		os.Remove(to.Name())
+		return "", fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", filename, expected, actual)
+	}
+	return to.Name(), nil
+}
+
+// ParseChecksums finds the checksum for filename in a `sha256sum` style file
+// (`<hash>  <filename>` per line, as published in GitHub releases as SHA256SUMS).
+// A file with a single bare hash (like docker's `.sha256` files) is also accepted, as are
+// lines labelled with their algorithm (`sha256: <hash>  <filename>`, as in RancherOS's
+// iso-checksums.txt), of which only the sha256 ones are used.
+func ParseChecksums(data []byte, filename string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			if !strings.EqualFold(fields[0], "sha256:") {
+				continue
+			}
+			fields = fields[1:]
+		}
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			if len(fields[0]) == sha256.Size*2 {
+				return fields[0], nil
+			}
+		default:
+			// sha256sum marks binary mode files with a leading '*'
+			name := strings.TrimPrefix(fields[1], "*")
+			if name == filename || path.Base(name) == filename {
+				return fields[0], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum found for %s", filename)
+}
@@ -0,0 +1,46 @@
+package util
+
+import "testing"
+
+const (
+	isoSum  = "0ab4a6b2ad3e6fc2e0bbbd5b4c21e7f5a4ad0d1f1f3c0e4a52e0d1c5f5ce4c3a"
+	toolSum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+func TestParseChecksums(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		filename string
+		want     string
+	}{
+		{"sha256sum", toolSum + "  tool-linux-amd64\n" + isoSum + "  rancheros.iso\n", "rancheros.iso", isoSum},
+		{"binary mode", toolSum + " *tool-linux-amd64\n", "tool-linux-amd64", toolSum},
+		{"path", toolSum + "  dist/linux/tool-linux-amd64\n", "tool-linux-amd64", toolSum},
+		{"bare hash", toolSum + "\n", "tool", toolSum},
+		{"blank lines", "\n\n" + toolSum + "  tool\n\n", "tool", toolSum},
+		{"labelled", "md5: 5d41402abc4b2a76b9719d911017c592  rancheros.iso\n" +
+			"sha1: aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d  rancheros.iso\n" +
+			"sha256: " + isoSum + "  rancheros.iso\n" +
+			"sha512: " + isoSum + isoSum + "  rancheros.iso\n", "rancheros.iso", isoSum},
+		{"missing", toolSum + "  tool-linux-amd64\n", "tool-darwin-amd64", ""},
+		{"prefix of another name", toolSum + "  tool-linux-amd64.sig\n", "tool-linux-amd64", ""},
+		{"short bare hash", "5d41402abc4b2a76b9719d911017c592\n", "tool", ""},
+		{"only md5", "md5: 5d41402abc4b2a76b9719d911017c592  rancheros.iso\n", "rancheros.iso", ""},
+		{"empty", "", "tool", ""},
+	}
+	for _, test := range tests {
+		sum, err := ParseChecksums([]byte(test.data), test.filename)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", test.name, sum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if sum != test.want {
+			t.Errorf("%s: got %s, expected %s", test.name, sum, test.want)
+		}
+	}
+}
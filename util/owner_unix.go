@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether the file is owned by the user desktop is running as
+func ownedByUser(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Geteuid()
+}
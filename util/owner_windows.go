@@ -0,0 +1,8 @@
+package util
+
+import "os"
+
+// ownedByUser is always true on Windows, where the user cache dir is in the user's profile
+func ownedByUser(fi os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Sudo is true when Batch needs sudo to change the install directories.
+// main sets it once, from CheckPrivileges.
+var Sudo = runtime.GOOS != "windows"
+
+// SudoErr is why sudo can't be used, when Sudo is needed. Batch returns it
+// rather than failing part way through.
+var SudoErr error
+
+// CheckPrivileges works out whether changing dirs needs sudo, and returns an error if it
+// does but sudo can't be used
+func CheckPrivileges(dirs ...string) (bool, error) {
+	notWritable := []string{}
+	for _, dir := range dirs {
+		if !Writable(dir) {
+			log.Debugf("%s is not writable", dir)
+			notWritable = append(notWritable, dir)
+		}
+	}
+	if len(notWritable) == 0 {
+		return false, nil
+	}
+	if !SudoAvailable() {
+		return true, fmt.Errorf("Changing %s needs administrator access, but sudo can't be used here", strings.Join(notWritable, " and "))
+	}
+	return true, nil
+}
+
+// Writable reports whether the user can create files in dir, or if it doesn't exist yet,
+// in the nearest parent that does
+func Writable(dir string) bool {
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		fi, err := os.Stat(d)
+		if err == nil {
+			if !fi.IsDir() {
+				return false
+			}
+			f, err := ioutil.TempFile(d, ".desktop-write-test")
+			if err != nil {
+				return false
+			}
+			f.Close()
+			os.Remove(f.Name())
+			return true
+		}
+		if !os.IsNotExist(err) || filepath.Dir(d) == d {
+			return false
+		}
+	}
+}
+
+// SudoAvailable reports whether sudo can be used: it's installed, and either doesn't need
+// a password, or there is a terminal to ask for one on
+func SudoAvailable() bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	if _, err := exec.LookPath("sudo"); err != nil {
+		return false
+	}
+	if exec.Command("sudo", "-n", "true").Run() == nil {
+		return true
+	}
+	return IsTerminal(os.Stdin)
+}
+
+// IsTerminal reports whether f is a terminal, rather than a file or pipe
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Batch is a list of commands that change the install directories. They are run together,
+// so sudo asks for a password at most once, up front and in plain sight.
+type Batch struct {
+	// Reason finishes the sentence "desktop needs administrator access to ..."
+	Reason string
+	// Root batches always run as root, even when the install directories don't need sudo
+	Root bool
+	cmds [][]string
+}
+
+// Add queues a command to run
+func (b *Batch) Add(cmd ...string) {
+	b.cmds = append(b.cmds, cmd)
+}
+
+// Len is the number of queued commands
+func (b *Batch) Len() int {
+	return len(b.cmds)
+}
+
+// Run runs the queued commands, stopping at the first that fails, and empties the batch
+func (b *Batch) Run() error {
+	cmds := b.cmds
+	b.cmds = nil
+	if len(cmds) == 0 {
+		return nil
+	}
+	sudo := Sudo
+	if b.Root {
+		sudo = os.Geteuid() != 0
+		if sudo && !SudoAvailable() {
+			return fmt.Errorf("desktop needs administrator access to %s, but sudo can't be used here", b.Reason)
+		}
+	} else if sudo && SudoErr != nil {
+		return SudoErr
+	}
+	if !sudo || runtime.GOOS == "windows" {
+		for _, cmd := range cmds {
+			if err := Run(cmd[0], cmd[1:]...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	script := []string{"set -e"}
+	// not through the log, so the user sees it above the password prompt
+	fmt.Fprintf(os.Stderr, "desktop needs administrator access to %s, running:\n", b.Reason)
+	for _, cmd := range cmds {
+		quoted := []string{}
+		for _, arg := range cmd {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		script = append(script, strings.Join(quoted, " "))
+		fmt.Fprintf(os.Stderr, "    %s\n", strings.Join(cmd, " "))
+	}
+	log.Debugf("sudo batch:\n%s", strings.Join(script, "\n"))
+
+	cmd := exec.Command("sudo", "sh", "-c", strings.Join(script, "\n"))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error running privileged commands to %s (%s)", b.Reason, err)
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
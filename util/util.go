@@ -3,20 +3,12 @@ package util
 import (
 	"bufio"
 	"fmt"
-	"runtime"
 
 	"os/exec"
 
 	log "github.com/Sirupsen/logrus"
 )
 
-func SudoRun(cmds ...string) error {
-	if runtime.GOOS == "windows" {
-		return Run(cmds[0], cmds[1:]...)
-	}
-	return Run("sudo", cmds...)
-}
-
 func Run(command string, args ...string) error {
 	logCmd := fmt.Sprintf("%s %v", command, args)
 	log.Debugf("Run %s", logCmd)
@@ -57,7 +49,7 @@ func Run(command string, args ...string) error {
 			log.Infof(outscanner.Text())
 		}
 	}()
-	if err := cmd.Wait(); err != nil {
+	if err = cmd.Wait(); err != nil {
 		streamingLog.Error(err)
 	}
 	return err
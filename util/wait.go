@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WaitBackoff is the delay after the first unsuccessful check in WaitFor, it doubles
+// after each following check, up to WaitMaxBackoff
+var WaitBackoff = 500 * time.Millisecond
+
+// WaitMaxBackoff is the longest delay between WaitFor checks
+var WaitMaxBackoff = 10 * time.Second
+
+// WaitFor calls ready until it returns true, backing off exponentially between calls.
+// It gives up with an error naming what it was waiting for after timeout, or when the user
+// presses Ctrl-C. Errors returned by ready are retried, and the last one is included in
+// the timeout error.
+func WaitFor(what string, timeout time.Duration, ready func() (bool, error)) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	// the cmd field makes the user log show progress dots instead of every line
+	progress := log.WithFields(log.Fields{
+		"cmd": "wait for " + what,
+	})
+	deadline := time.After(timeout)
+	wait := WaitBackoff
+	var lastErr error
+	for tries := 1; ; tries++ {
+		ok, err := ready()
+		if ok {
+			log.Debugf("%s ready after %d tries", what, tries)
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+			log.Debugf("%d: %s not ready: %s", tries, what, err)
+		}
+		progress.Infof("%d: waiting %s for %s", tries, wait, what)
+
+		select {
+		case <-time.After(wait):
+		case <-deadline:
+			if lastErr != nil {
+				return fmt.Errorf("Timed out after %s waiting for %s (%s)", timeout, what, lastErr)
+			}
+			return fmt.Errorf("Timed out after %s waiting for %s", timeout, what)
+		case <-interrupt:
+			return fmt.Errorf("Cancelled waiting for %s", what)
+		}
+
+		wait *= 2
+		if wait > WaitMaxBackoff {
+			wait = WaitMaxBackoff
+		}
+	}
+}